@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+)
+
+type listUsersParams struct {
+	Search string `form:"q"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
+}
+
+type listAuditParams struct {
+	Actor  string `form:"actor"`
+	Target string `form:"target"`
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
+}
+
+type suspendUserParams struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+type setRolesParams struct {
+	Roles []string `json:"roles" binding:"required"`
+}
+
+type adjustBalanceParams struct {
+	Amount int    `json:"amount" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+	Note   string `json:"note,omitempty"`
+}
+
+// listUsers returns a page of users whose username contains the q query param.
+func (a *api) listUsers(c *gin.Context) {
+	params := listUsersParams{}
+
+	err := c.ShouldBindQuery(&params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query params"})
+		return
+	}
+
+	page, err := a.s.ListUsers(c.Request.Context(), params.Search, params.Cursor, params.Limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to list users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// adminGetUser returns the account of any user.
+func (a *api) adminGetUser(c *gin.Context) {
+	user, err := a.s.GetUser(c.Request.Context(), c.Param("username"))
+	if err != nil {
+		a.respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// suspendUser prevent the user from logging in and log it out of every session.
+func (a *api) suspendUser(c *gin.Context) {
+	params := suspendUserParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	user, err := a.s.SuspendUser(c.Request.Context(), c.GetString(usernameContext), c.Param("username"), params.Reason)
+	if err != nil {
+		a.respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// reactivateUser let a suspended user login again.
+func (a *api) reactivateUser(c *gin.Context) {
+	user, err := a.s.ReactivateUser(c.Request.Context(), c.GetString(usernameContext), c.Param("username"))
+	if err != nil {
+		a.respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// forceLogout revoke every session of the user.
+func (a *api) forceLogout(c *gin.Context) {
+	err := a.s.ForceLogout(c.Request.Context(), c.GetString(usernameContext), c.Param("username"))
+	if err != nil {
+		a.respondAdminError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// setRoles replace the roles of the user, the new permissions apply to access tokens issued
+// from now on.
+func (a *api) setRoles(c *gin.Context) {
+	params := setRolesParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	user, err := a.s.SetRoles(c.Request.Context(), c.GetString(usernameContext), c.Param("username"), params.Roles)
+	if err != nil {
+		a.respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// adjustBalance credits or debits the user deposit with a reason code.
+func (a *api) adjustBalance(c *gin.Context) {
+	params := adjustBalanceParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	user, err := a.s.AdjustBalance(c.Request.Context(), c.GetString(usernameContext), c.Param("username"), params.Amount, params.Reason, params.Note)
+	if err != nil {
+		if err == vendingmachine.ErrInsufficientDeposit {
+			c.JSON(http.StatusConflict, gin.H{"message": "Deposit is not enough to debit the amount"})
+			return
+		}
+
+		a.respondAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// unlockUser forget failed logins of the user.
+func (a *api) unlockUser(c *gin.Context) {
+	err := a.s.UnlockUser(c.Request.Context(), c.GetString(usernameContext), c.Param("username"))
+	if err != nil {
+		a.respondAdminError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// listAudit returns a page of the audit trail newest first.
+func (a *api) listAudit(c *gin.Context) {
+	params := listAuditParams{}
+
+	err := c.ShouldBindQuery(&params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query params"})
+		return
+	}
+
+	query := models.AuditQuery{Actor: params.Actor, Target: params.Target, Limit: params.Limit}
+
+	page, err := a.s.AuditTrail(c.Request.Context(), query, params.Cursor)
+	if err != nil {
+		if err == vendingmachine.ErrInvalidCursor {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to list audit trail"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (a *api) respondAdminError(c *gin.Context, err error) {
+	if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+		respondValidationError(c, validationErr)
+		return
+	}
+
+	switch err {
+	case vendingmachine.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+	case vendingmachine.ErrSelfAdministration:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Admins cannot apply this action to their own account"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminUserManagement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer, seller := testUsers[0].Username, testUsers[1].Username
+
+	ctx := context.Background()
+
+	admin, err := api.s.CreateAdmin(ctx, "@test", "admin1", "vending-pass1")
+	assert.NoError(t, err)
+
+	session, _, err := api.s.NewSession(ctx, "admin1", "", "")
+	assert.NoError(t, err)
+
+	adminToken, err := api.newAPIToken(admin, session.ID, api.config.AccessTokenTTL)
+	assert.NoError(t, err)
+
+	request := func(method, path, token string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// admin endpoints are reserved to admins.
+	rr := request(http.MethodGet, "/admin/users", userToken[buyer], nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/admin/users?q=seller", adminToken, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	users := models.UserPage{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&users)
+	assert.NoError(t, err)
+	assert.Len(t, users.Users, 1)
+	assert.Equal(t, seller, users.Users[0].Username)
+
+	rr = request(http.MethodGet, "/admin/users?limit=1", adminToken, nil)
+	users = models.UserPage{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&users)
+	assert.NoError(t, err)
+	assert.Len(t, users.Users, 1)
+	assert.Equal(t, "admin1", users.NextCursor)
+
+	// suspension requires a reason, logs the user out and blocks new logins.
+	rr = request(http.MethodPost, "/admin/users/"+buyer+"/suspend", adminToken, gin.H{})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/admin/users/"+buyer+"/suspend", adminToken, &suspendUserParams{Reason: "fraud"})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/user", userToken[buyer], nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/login", "", &logInParams{Username: buyer, Password: "vending-pass1"})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/admin/users/admin1/suspend", adminToken, &suspendUserParams{Reason: "mistake"})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/admin/users/"+buyer+"/reactivate", adminToken, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/login", "", &logInParams{Username: buyer, Password: "vending-pass1"})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	// balance adjustments need a known reason code and are reflected in the ledger.
+	rr = request(http.MethodPost, "/admin/users/"+buyer+"/balance", adminToken, &adjustBalanceParams{Amount: 50, Reason: "because"})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/admin/users/"+buyer+"/balance", adminToken, &adjustBalanceParams{Amount: 50, Reason: "goodwill", Note: "jammed slot"})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/admin/users/"+buyer+"/balance", adminToken, &adjustBalanceParams{Amount: -100, Reason: "correction"})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	// a user without deposit is credited in the default currency.
+	user, err := api.s.GetUser(ctx, buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, 50, user.Deposit)
+	assert.Equal(t, "EUR", user.DepositCurrency)
+
+	reconciliation, err := api.s.Reconcile(ctx)
+	assert.NoError(t, err)
+	assert.True(t, reconciliation.OK())
+
+	_, refreshToken, err := api.s.NewSession(ctx, seller, "", "")
+	assert.NoError(t, err)
+
+	rr = request(http.MethodPut, "/admin/users/"+seller+"/roles", adminToken, &setRolesParams{Roles: []string{"seller", "buyer"}})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	// tokens issued with the previous roles are revoked.
+	rr = request(http.MethodGet, "/user", userToken[seller], nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	_, _, err = api.s.RefreshSession(ctx, refreshToken)
+	assert.Equal(t, vendingmachine.ErrInvalidRefreshToken, err)
+
+	rr = request(http.MethodPut, "/admin/users/"+seller+"/roles", adminToken, &setRolesParams{Roles: []string{"owner"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/admin/users/missing/logout", adminToken, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+
+	// every action is recorded, newest first.
+	rr = request(http.MethodGet, "/admin/audit?target="+buyer, adminToken, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	trail := models.AuditPage{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&trail)
+	assert.NoError(t, err)
+
+	actions := []string{}
+	for _, entry := range trail.Entries {
+		assert.Equal(t, "admin1", entry.Actor)
+		actions = append(actions, entry.Action)
+	}
+	assert.Equal(t, []string{models.AuditUserBalance, models.AuditUserReactivate, models.AuditUserSuspend}, actions)
+	assert.Equal(t, "goodwill", trail.Entries[0].Reason)
+	assert.Equal(t, "jammed slot", trail.Entries[0].Details["note"])
+	assert.Equal(t, "fraud", trail.Entries[2].Reason)
+
+	rr = request(http.MethodGet, "/admin/audit?limit=1", adminToken, nil)
+	trail = models.AuditPage{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&trail)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AuditUserRoles, trail.Entries[0].Action)
+
+	rr = request(http.MethodGet, "/admin/audit?cursor="+trail.NextCursor, adminToken, nil)
+	trail = models.AuditPage{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&trail)
+	assert.NoError(t, err)
+	assert.Equal(t, models.AuditUserBalance, trail.Entries[0].Action)
+	assert.Equal(t, models.AuditAdminCreate, trail.Entries[len(trail.Entries)-1].Action)
+}
@@ -10,54 +10,146 @@ import (
 	"time"
 
 	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/service"
 	"github.com/bcmmbaga/vending-machine/storage"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
-	usernameContext = "username"
+	usernameContext    = "username"
+	sessionContext     = "session"
+	rolesContext       = "roles"
+	permissionsContext = "permissions"
+	apiKeyContext      = "apikey"
 )
 
 type api struct {
-	// s vendingmachine.Service
+	s       vendingmachine.Service
 	handler http.Handler
 
-	db *mongo.Database
+	store      storage.Store
+	keys       *keySet
+	roles      models.Roles
+	currencies models.Currencies
 
 	config *vendingmachine.Config
 }
 
-// NewServer initiate new http.Handler with API endpoints to serve.
-func NewServer(config *vendingmachine.Config, conn *storage.Connection) *api {
-	api := &api{config: config, db: conn.Database(config.DatabaseName)}
+// NewServer initiate new http.Handler with API endpoints to serve, state is persisted in the
+// given store which can be either a mongo Connection or an in-memory store.
+func NewServer(config *vendingmachine.Config, store storage.Store) (*api, error) {
+	keys, err := loadKeySet(config)
+	if err != nil {
+		return nil, err
+	}
+
+	notifier, err := notify.New(config)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := config.Roles
+	if roles == nil {
+		roles = models.DefaultRoles()
+	}
+
+	currencies := config.Currencies
+	if currencies == nil {
+		currencies = models.DefaultCurrencies()
+	}
+
+	api := &api{
+		s:          service.New(store, notifier, config),
+		store:      store,
+		keys:       keys,
+		roles:      roles,
+		currencies: currencies,
+		config:     config,
+	}
 
 	r := gin.Default()
 
 	r.Use(api.authenticationMiddleware)
 
-	user := r.Group("/user")
+	user := r.Group("/user", api.sessionOnlyMiddleware)
 	user.GET("", api.GetUser)
 	user.POST("", api.SignUpNewUser)
 	user.DELETE("", api.DeleteUser)
+	user.PUT("/password", api.changePassword)
+	user.POST("/totp", api.enrolTOTP)
+	user.POST("/totp/confirm", api.confirmTOTP)
+	user.DELETE("/totp", api.disableTOTP)
+	user.GET("/keys", api.listAPIKeys)
+	user.POST("/keys", api.createAPIKey)
+	user.DELETE("/keys/:id", api.revokeAPIKey)
 
 	product := r.Group("/product")
+	product.GET("", api.ListProducts)
 	product.GET("/:id", api.GetProduct)
-	product.Use(api.sellerOnlyMiddleware())
+	product.Use(api.permissionMiddleware(models.PermProductWrite))
 	product.POST("", api.NewProduct)
 	product.PUT("/:id", api.UpdateProduct)
 	product.DELETE("/:id", api.DeleteProduct)
 
-	r.POST("/deposit", api.buyersOnlyMiddleware(), api.deposit)
+	r.GET("/currencies", api.listCurrencies)
+
+	machines := r.Group("/machines")
+	machines.GET("", api.listMachines)
+	machines.GET("/:id", api.getMachine)
+	machines.GET("/:id/slots", api.listSlots)
+	machines.GET("/:id/slots/:code", api.getSlot)
+	machines.Use(api.permissionMiddleware(models.PermMachineWrite))
+	machines.POST("", api.newMachine)
+	machines.PUT("/:id", api.updateMachine)
+	machines.DELETE("/:id", api.deleteMachine)
+	machines.POST("/:id/slots", api.newSlot)
+	machines.PUT("/:id/slots/:code", api.updateSlot)
+	machines.DELETE("/:id/slots/:code", api.deleteSlot)
+	machines.GET("/:id/cash", api.machineCash)
+	machines.GET("/:id/cash/movements", api.listCashMovements)
+	machines.POST("/:id/cash/collections", api.collectCash)
+	machines.POST("/:id/cash/float", api.topUpFloat)
+
+	r.GET("/.well-known/jwks.json", api.jwks)
+	r.POST("/deposit", api.permissionMiddleware(models.PermDepositCreate), api.idempotencyMiddleware, api.deposit)
 	r.POST("/login", api.logIn)
-	r.POST("/logout", api.revokeAllSessions)
-	r.POST("/logout/all", api.revokeAllSessions)
-	r.POST("/reset", api.buyersOnlyMiddleware(), api.ResetDeposit)
-	r.POST("/buy", api.buyersOnlyMiddleware(), api.buyProduct)
+	r.POST("/token/refresh", api.refreshToken)
+	r.POST("/password/forgot", api.forgotPassword)
+	r.POST("/password/reset", api.resetPassword)
+	r.POST("/logout", api.sessionOnlyMiddleware, api.revokeSession)
+	r.POST("/logout/all", api.sessionOnlyMiddleware, api.revokeAllSessions)
+	r.GET("/sessions", api.sessionOnlyMiddleware, api.listSessions)
+	r.POST("/reset", api.permissionMiddleware(models.PermDepositCreate), api.idempotencyMiddleware, api.ResetDeposit)
+	r.POST("/buy", api.permissionMiddleware(models.PermOrderCreate), api.idempotencyMiddleware, api.buyProduct)
+	r.POST("/checkout", api.permissionMiddleware(models.PermOrderCreate), api.idempotencyMiddleware, api.checkout)
+	r.GET("/checkout/:id", api.permissionMiddleware(models.PermOrderRead), api.GetCheckout)
+
+	seller := r.Group("/seller")
+	seller.GET("/earnings", api.permissionMiddleware(models.PermSalesRead), api.earnings)
+	seller.POST("/payouts", api.permissionMiddleware(models.PermPayoutCreate), api.payout)
+
+	orders := r.Group("/orders", api.permissionMiddleware(models.PermOrderRead))
+	orders.GET("", api.ListOrders)
+	orders.GET("/:id", api.GetOrder)
+
+	admin := r.Group("/admin")
+	admin.GET("/audit", api.permissionMiddleware(models.PermAuditRead), api.listAudit)
+
+	users := admin.Group("/users", api.permissionMiddleware(models.PermUserAdmin))
+	users.GET("", api.listUsers)
+	users.GET("/:username", api.adminGetUser)
+	users.POST("/:username/suspend", api.suspendUser)
+	users.POST("/:username/reactivate", api.reactivateUser)
+	users.POST("/:username/logout", api.forceLogout)
+	users.PUT("/:username/roles", api.setRoles)
+	users.POST("/:username/balance", api.adjustBalance)
+	users.POST("/:username/unlock", api.unlockUser)
 
 	api.handler = r
 
-	return api
+	return api, nil
 }
 
 func (s *api) Start() error {
@@ -72,7 +164,7 @@ func (s *api) Start() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
 
-		s.db.Client().Disconnect(ctx)
+		s.store.Close(ctx)
 		ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
 		defer cancel()
 
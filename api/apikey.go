@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyHeader carries API keys, it is used instead of the Authorization header.
+const apiKeyHeader = "X-API-Key"
+
+type createAPIKeyParams struct {
+	Name      string     `json:"name" binding:"required"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type createAPIKeyResp struct {
+	*models.APIKey
+
+	// Key is only returned when the key is created.
+	Key string `json:"key"`
+}
+
+// createAPIKey returns a new API key of the user making the request.
+func (a *api) createAPIKey(c *gin.Context) {
+	params := createAPIKeyParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	apiKey, key, err := a.s.CreateAPIKey(c.Request.Context(), c.GetString(usernameContext), params.Name, params.Scopes, params.ExpiresAt)
+	if err != nil {
+		if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+			respondValidationError(c, validationErr)
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create api key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &createAPIKeyResp{APIKey: apiKey, Key: key})
+}
+
+// listAPIKeys returns the API keys of the user making the request.
+func (a *api) listAPIKeys(c *gin.Context) {
+	keys, err := a.s.APIKeys(c.Request.Context(), c.GetString(usernameContext))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to list api keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// revokeAPIKey stop accepting an API key of the user making the request.
+func (a *api) revokeAPIKey(c *gin.Context) {
+	err := a.s.RevokeAPIKey(c.Request.Context(), c.GetString(usernameContext), c.Param("id"))
+	if err != nil {
+		if err == vendingmachine.ErrAPIKeyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "API key not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to revoke api key"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer, seller := testUsers[0].Username, testUsers[1].Username
+
+	request := func(method, path string, header string, value string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(header, value)
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	createKey := func(params *createAPIKeyParams) (*httptest.ResponseRecorder, createAPIKeyResp) {
+		rr := request(http.MethodPost, "/user/keys", "Authorization", userToken[seller], params)
+
+		resp := createAPIKeyResp{}
+		_ = json.NewDecoder(rr.Result().Body).Decode(&resp)
+		return rr, resp
+	}
+
+	// scopes are limited to the permissions of the user.
+	rr, _ := createKey(&createAPIKeyParams{Name: "restock", Scopes: []string{models.PermProductWrite, models.PermDepositCreate}})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	past := time.Now().Add(-time.Hour)
+	rr, _ = createKey(&createAPIKeyParams{Name: "restock", Scopes: []string{models.PermProductWrite}, ExpiresAt: &past})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr, restock := createKey(&createAPIKeyParams{Name: "restock", Scopes: []string{models.PermProductWrite}})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	assert.NotEmpty(t, restock.Key)
+	assert.Equal(t, restock.Key[:len(restock.Prefix)], restock.Prefix)
+
+	rr, earnings := createKey(&createAPIKeyParams{Name: "reports", Scopes: []string{models.PermSalesRead}})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/product", apiKeyHeader, restock.Key, &newProductParams{Name: "Cola", Available: 5, Cost: 45})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	// keys only carry their scopes and cannot manage the account.
+	rr = request(http.MethodGet, "/seller/earnings", apiKeyHeader, restock.Key, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/seller/earnings", apiKeyHeader, earnings.Key, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/user/keys", apiKeyHeader, restock.Key, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/seller/earnings", apiKeyHeader, "vmk_unknown", nil)
+	assert.Equal(t, http.StatusUnauthorized, rr.Result().StatusCode)
+
+	// keys are listed without the key itself and with their last use.
+	rr = request(http.MethodGet, "/user/keys", "Authorization", userToken[seller], nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+	assert.NotContains(t, rr.Body.String(), restock.Key)
+
+	keys := []*models.APIKey{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&keys)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "restock", keys[0].Name)
+	assert.NotNil(t, keys[0].LastUsedAt)
+
+	// other users cannot revoke the key.
+	rr = request(http.MethodDelete, "/user/keys/"+restock.ID, "Authorization", userToken[buyer], nil)
+	assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+
+	rr = request(http.MethodDelete, "/user/keys/"+restock.ID, "Authorization", userToken[seller], nil)
+	assert.Equal(t, http.StatusNoContent, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/product", apiKeyHeader, restock.Key, &newProductParams{Name: "Water", Available: 5, Cost: 15})
+	assert.Equal(t, http.StatusUnauthorized, rr.Result().StatusCode)
+
+	// keys lose permissions removed from the user roles.
+	_, err = api.s.UpdateUser(context.Background(), seller, models.UserUpdate{Roles: []string{"buyer"}})
+	assert.NoError(t, err)
+
+	rr = request(http.MethodGet, "/seller/earnings", apiKeyHeader, earnings.Key, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
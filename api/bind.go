@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+func init() {
+	// report binding errors with json field names instead of Go ones.
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+	}
+}
+
+// bindJSON decode the request body into params and check its binding rules, the request
+// is answered and false returned when the body is rejected.
+func bindJSON(c *gin.Context, params interface{}) bool {
+	err := c.ShouldBindJSON(params)
+	if err == nil {
+		return true
+	}
+
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		c.JSON(http.StatusBadRequest, err)
+	case *json.UnmarshalTypeError:
+		validation := &vendingmachine.ValidationError{}
+		validation.Add(err.Field, "must be a "+err.Type.String())
+		respondValidationError(c, validation)
+	case validator.ValidationErrors:
+		validation := &vendingmachine.ValidationError{}
+		for _, fieldErr := range err {
+			validation.Add(fieldErr.Field(), fieldRuleMessage(fieldErr))
+		}
+		respondValidationError(c, validation)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+	}
+
+	return false
+}
+
+// respondValidationError answer with every rejected field of the request.
+func respondValidationError(c *gin.Context, err *vendingmachine.ValidationError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{
+		"message": "Request validation failed",
+		"errors":  err.Fields,
+	})
+}
+
+// fieldRuleMessage returns the sentence describing the binding rule the field broke, every
+// rule used by the request params has its own message.
+func fieldRuleMessage(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required", "required_without":
+		return "is required"
+	case "min":
+		if err.Kind() == reflect.Slice {
+			return "must hold at least " + err.Param() + " item(s)"
+		}
+		return "must be at least " + err.Param()
+	case "gt":
+		return "must be greater than " + err.Param()
+	default:
+		return "is invalid"
+	}
+}
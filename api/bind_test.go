@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindJSONMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	bind := func(body string, params interface{}) []vendingmachine.FieldError {
+		rr := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(rr)
+		c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		assert.False(t, bindJSON(c, params))
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		resp := struct {
+			Errors []vendingmachine.FieldError `json:"errors"`
+		}{}
+		err := json.NewDecoder(rr.Body).Decode(&resp)
+		assert.NoError(t, err)
+
+		return resp.Errors
+	}
+
+	assert.Equal(t, []vendingmachine.FieldError{
+		{Field: "name", Message: "is required"},
+		{Field: "available", Message: "must be at least 0"},
+		{Field: "cost", Message: "must be greater than 0"},
+	}, bind(`{"available": -1, "cost": -5}`, &newProductParams{}))
+
+	assert.Equal(t, []vendingmachine.FieldError{
+		{Field: "items", Message: "must hold at least 1 item(s)"},
+	}, bind(`{"machineId": "lobby", "items": []}`, &checkoutParams{}))
+}
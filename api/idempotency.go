@@ -0,0 +1,143 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotentReplayedHeader is set on responses replayed from a previous request.
+	idempotentReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// errRequestFailed roll back the transaction of a request answered with an error.
+var errRequestFailed = errors.New("request failed")
+
+// responseRecorder holds the response written through it until flush is called, so it is
+// only sent once the response is saved.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// flush send the held response.
+func (w *responseRecorder) flush() {
+	w.ResponseWriter.WriteHeaderNow()
+	_, _ = w.ResponseWriter.Write(w.body.Bytes())
+}
+
+// idempotencyMiddleware apply requests made with an Idempotency-Key header once, retries
+// with the same key and request get the original response. The request runs in a store
+// transaction which also saves its response, so a request is never applied without its
+// response being saved. Error responses roll the transaction back, they are saved once it
+// is, and server errors are not remembered so the request can be retried.
+func (a *api) idempotencyMiddleware(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Idempotency-Key must be at most 255 characters"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Failed to read request body"})
+		return
+	}
+	c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	hash := models.RequestHash(c.Request.Method, c.Request.URL.Path, body)
+
+	req, replay, err := a.s.BeginRequest(c.Request.Context(), c.GetString(usernameContext), key, hash)
+	if err != nil {
+		switch err {
+		case vendingmachine.ErrIdempotencyKeyReuse:
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"message": "Idempotency-Key was already used with a different request"})
+		case vendingmachine.ErrRequestInProgress:
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": "A request with this Idempotency-Key is still in progress"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
+		}
+		return
+	}
+
+	if replay {
+		c.Header(idempotentReplayedHeader, "true")
+		c.Data(req.Status, req.ContentType, req.Body)
+		c.Abort()
+		return
+	}
+
+	parent := c.Request.Context()
+	recorder := &responseRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+
+	attempted := false
+	err = a.store.WithTransaction(parent, func(ctx context.Context) error {
+		// the handlers cannot run twice, a transaction retried by the store is given up.
+		if attempted {
+			return errRequestFailed
+		}
+		attempted = true
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		// transactions of the handlers join this one, failing requests must roll it back
+		// for them.
+		if recorder.Status() >= http.StatusBadRequest {
+			return errRequestFailed
+		}
+
+		return a.s.CompleteRequest(ctx, req, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+	})
+
+	c.Request = c.Request.WithContext(parent)
+	c.Writer = recorder.ResponseWriter
+
+	// the outcome is saved even when the client went away before reading it, that is when
+	// the client retries.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	switch {
+	case err == nil:
+		recorder.flush()
+	case err == errRequestFailed && recorder.Status() >= http.StatusBadRequest && recorder.Status() < http.StatusInternalServerError:
+		_ = a.s.CompleteRequest(ctx, req, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+		recorder.flush()
+	case err == errRequestFailed && recorder.Status() >= http.StatusInternalServerError:
+		_ = a.s.AbortRequest(ctx, req)
+		recorder.flush()
+	case err == vendingmachine.ErrRequestInProgress:
+		// a retry took the request over, it is applied by the retry instead.
+		c.JSON(http.StatusConflict, gin.H{"message": "A request with this Idempotency-Key is still in progress"})
+	default:
+		_ = a.s.AbortRequest(ctx, req)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
+	}
+}
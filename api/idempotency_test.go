@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer, seller := testUsers[0].Username, testUsers[1].Username
+	ctx := context.Background()
+
+	request := func(path string, token string, key string, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	deposit := `{"machineId": "` + machineId + `", "coins": [10, 10]}`
+
+	first := request("/deposit", userToken[buyer], "deposit-1", deposit)
+	assert.Equal(t, http.StatusOK, first.Result().StatusCode)
+
+	// the retry is not applied again and gets the original response.
+	replay := request("/deposit", userToken[buyer], "deposit-1", deposit)
+	assert.Equal(t, http.StatusOK, replay.Result().StatusCode)
+	assert.Equal(t, "true", replay.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+
+	user, err := api.s.GetUser(ctx, buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, user.Deposit)
+
+	rr := request("/deposit", userToken[buyer], "deposit-1", `{"machineId": "`+machineId+`", "coins": [5]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	// keys are scoped to the user, the same key on another endpoint is another request.
+	buy := `{"machineId": "` + machineId + `", "slot": "A1", "quantity": 2}`
+
+	first = request("/buy", userToken[buyer], "buy-1", buy)
+	assert.Equal(t, http.StatusOK, first.Result().StatusCode)
+
+	replay = request("/buy", userToken[buyer], "buy-1", buy)
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+
+	rr = request("/reset", userToken[buyer], "deposit-1", "")
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	slot, err := api.s.GetSlot(ctx, machineId, "A1")
+	assert.NoError(t, err)
+	assert.Equal(t, 28, slot.Count)
+
+	// failed requests are replayed too, without a key they are applied again.
+	rr = request("/buy", userToken[buyer], "buy-2", buy)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request("/deposit", userToken[buyer], "", deposit)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request("/buy", userToken[buyer], "buy-2", buy)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+	assert.Equal(t, "true", rr.Header().Get(idempotentReplayedHeader))
+
+	rr = request("/buy", userToken[buyer], "buy-3", buy)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request("/deposit", userToken[seller], "deposit-1", deposit)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request("/deposit", userToken[buyer], strings.Repeat("k", 256), deposit)
+	assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode)
+
+	// a pending request is left to the attempt holding its lease, a retry takes it over
+	// once the lease expired and the stale attempt can no longer save its response.
+	hash := models.RequestHash(http.MethodPost, "/deposit", []byte(deposit))
+
+	running := models.NewIdempotentRequest(buyer, "deposit-2", hash, time.Hour, time.Minute)
+	err = api.store.CreateIdempotentRequest(ctx, running)
+	assert.NoError(t, err)
+
+	rr = request("/deposit", userToken[buyer], "deposit-2", deposit)
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	crashed := models.NewIdempotentRequest(buyer, "deposit-3", hash, time.Hour, -time.Second)
+	err = api.store.CreateIdempotentRequest(ctx, crashed)
+	assert.NoError(t, err)
+
+	rr = request("/deposit", userToken[buyer], "deposit-3", deposit)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	err = api.s.CompleteRequest(ctx, crashed, http.StatusOK, "application/json", []byte("{}"))
+	assert.Equal(t, vendingmachine.ErrRequestInProgress, err)
+
+	replay = request("/deposit", userToken[buyer], "deposit-3", deposit)
+	assert.Equal(t, "true", replay.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, rr.Body.String(), replay.Body.String())
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
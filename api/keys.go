@@ -0,0 +1,212 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/golang-jwt/jwt"
+)
+
+var errUnknownKey = errors.New("unknown token signing key")
+
+// signingKey is a key identified by kid that tokens are verified with, keys that still
+// hold their private part can sign tokens too.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// keySet holds the keys tokens are signed and verified with. Without a key directory
+// tokens are signed with the HS256 secret from config and no key is published.
+type keySet struct {
+	secret  []byte
+	signing *signingKey
+	keys    map[string]*signingKey
+}
+
+// loadKeySet read every PEM file of the configured key directory, the file name without
+// extension is used as kid. The key named in config signs new tokens, otherwise the last
+// private key in file name order does, the others are kept to verify tokens they signed.
+func loadKeySet(config *vendingmachine.Config) (*keySet, error) {
+	set := &keySet{secret: []byte(config.Secret), keys: map[string]*signingKey{}}
+	if config.KeyDir == "" {
+		return set, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(config.KeyDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := parseSigningKey(strings.TrimSuffix(filepath.Base(file), ".pem"), data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		set.keys[key.id] = key
+		if key.private != nil && config.SigningKeyID == "" {
+			set.signing = key
+		}
+	}
+
+	if config.SigningKeyID != "" {
+		set.signing = set.keys[config.SigningKeyID]
+	}
+
+	if set.signing == nil || set.signing.private == nil {
+		return nil, fmt.Errorf("no private signing key found in %s", config.KeyDir)
+	}
+
+	return set, nil
+}
+
+// parseSigningKey parse a PKCS8 or PKCS1 private key, or a PKIX public key for keys that
+// are only kept to verify tokens, either RSA or Ed25519.
+func parseSigningKey(id string, data []byte) (*signingKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{id: id}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+	case "RSA PRIVATE KEY":
+		private, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.private = private
+	case "PUBLIC KEY":
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key.public = public
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch private := key.private.(type) {
+	case *rsa.PrivateKey:
+		key.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		key.public = private.Public()
+	}
+
+	switch key.public.(type) {
+	case *rsa.PublicKey:
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, errors.New("unsupported key type, expected RSA or Ed25519")
+	}
+
+	return key, nil
+}
+
+// sign returns the signed token of the claims, the kid header names the key used.
+func (k *keySet) sign(claims jwt.Claims) (string, error) {
+	if k.signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+
+	return token.SignedString(k.signing.private)
+}
+
+// parse verify the token with the key named by its kid header and decode its claims.
+func (k *keySet) parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	if k.signing == nil {
+		p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
+		return p.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			return k.secret, nil
+		})
+	}
+
+	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		id, _ := token.Header["kid"].(string)
+
+		key, ok := k.keys[id]
+		if !ok || token.Method.Alg() != key.method.Alg() {
+			return nil, errUnknownKey
+		}
+
+		return key.public, nil
+	})
+}
+
+// jsonWebKey is the RFC 7517 representation of a public verification key.
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jwks returns the public part of every key, ordered by kid.
+func (k *keySet) jwks() *jsonWebKeySet {
+	set := &jsonWebKeySet{Keys: []jsonWebKey{}}
+
+	for _, key := range k.keys {
+		jwk := jsonWebKey{KeyID: key.id, Use: "sig", Algorithm: key.method.Alg()}
+
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].KeyID < set.Keys[j].KeyID
+	})
+
+	return set
+}
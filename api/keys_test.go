@@ -0,0 +1,107 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKey(t *testing.T, dir string, id string, key interface{}) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	err = ioutil.WriteFile(filepath.Join(dir, id+".pem"), data, 0600)
+	assert.NoError(t, err)
+}
+
+func TestKeyRotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	config.KeyDir = dir
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	writeKey(t, dir, "2026-01", rsaKey)
+
+	// tokens signed before the rotation.
+	oldKeys, err := loadKeySet(config)
+	assert.NoError(t, err)
+
+	claims := &apiTokenClaims{StandardClaims: jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Minute).Unix()}, Username: "buyer1"}
+	oldToken, err := oldKeys.sign(claims)
+	assert.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	writeKey(t, dir, "2026-07", edKey)
+
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-07", api.keys.signing.id)
+
+	newToken, err := api.keys.sign(claims)
+	assert.NoError(t, err)
+
+	for _, token := range []string{oldToken, newToken} {
+		parsed, err := api.keys.parse(token, &apiTokenClaims{})
+		assert.NoError(t, err)
+		assert.Equal(t, "buyer1", parsed.Claims.(*apiTokenClaims).Username)
+	}
+
+	parsed, err := api.keys.parse(newToken, &apiTokenClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+	assert.Equal(t, "2026-07", parsed.Header["kid"])
+
+	// tokens signed with the shared secret are no longer accepted.
+	hmacToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Secret))
+	assert.NoError(t, err)
+
+	_, err = api.keys.parse(hmacToken, &apiTokenClaims{})
+	assert.Error(t, err)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	api.handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	jwks := jsonWebKeySet{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&jwks)
+	assert.NoError(t, err)
+
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.Equal(t, "RS256", jwks.Keys[0].Algorithm)
+	assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+	assert.Equal(t, "Ed25519", jwks.Keys[1].Curve)
+
+	// a configured key ID overrides the file name order.
+	config.SigningKeyID = "2026-01"
+	keys, err := loadKeySet(config)
+	assert.NoError(t, err)
+	assert.Equal(t, "2026-01", keys.signing.id)
+
+	config.SigningKeyID = "missing"
+	_, err = loadKeySet(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"net/http"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+)
+
+type machineParams struct {
+	Name     string `json:"name" binding:"required"`
+	Location string `json:"location"`
+	Currency string `json:"currency"`
+}
+
+type updateMachineParams struct {
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Status   string `json:"status"`
+}
+
+type slotParams struct {
+	Code      string `json:"code" binding:"required"`
+	ProductID string `json:"productId"`
+	Capacity  int    `json:"capacity" binding:"required"`
+	Count     int    `json:"count"`
+}
+
+type machineCoinsParams struct {
+	Coins models.CoinInventory `json:"coins"`
+}
+
+type updateSlotParams struct {
+	ProductID string `json:"productId"`
+	Capacity  int    `json:"capacity"`
+	Count     *int   `json:"count"`
+}
+
+func (a *api) newMachine(c *gin.Context) {
+	params := machineParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	machine, err := a.s.NewMachine(c.Request.Context(), params.Name, params.Location, params.Currency)
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, machine)
+}
+
+func (a *api) listMachines(c *gin.Context) {
+	machines, err := a.s.ListMachines(c.Request.Context())
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, machines)
+}
+
+func (a *api) getMachine(c *gin.Context) {
+	machine, err := a.s.GetMachine(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, machine)
+}
+
+func (a *api) updateMachine(c *gin.Context) {
+	params := updateMachineParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	machine, err := a.s.UpdateMachine(c.Request.Context(), c.Param("id"), models.MachineUpdate{
+		Name:     params.Name,
+		Location: params.Location,
+		Status:   params.Status,
+	})
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, machine)
+}
+
+func (a *api) deleteMachine(c *gin.Context) {
+	machine, err := a.s.DeleteMachine(c.Request.Context(), c.GetString(usernameContext), c.Param("id"))
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, machine)
+}
+
+func (a *api) newSlot(c *gin.Context) {
+	params := slotParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	slot, err := a.s.NewSlot(c.Request.Context(), c.Param("id"), params.Code, params.ProductID, params.Capacity, params.Count)
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, slot)
+}
+
+func (a *api) listSlots(c *gin.Context) {
+	slots, err := a.s.Slots(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, slots)
+}
+
+func (a *api) getSlot(c *gin.Context) {
+	slot, err := a.s.GetSlot(c.Request.Context(), c.Param("id"), c.Param("code"))
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, slot)
+}
+
+// updateSlot change the product, capacity or count of a slot, a count omitted from the
+// request is left unchanged.
+func (a *api) updateSlot(c *gin.Context) {
+	params := updateSlotParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	slot, err := a.s.UpdateSlot(c.Request.Context(), c.Param("id"), c.Param("code"), models.SlotUpdate{
+		ProductID: params.ProductID,
+		Capacity:  params.Capacity,
+		Count:     params.Count,
+	})
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, slot)
+}
+
+func (a *api) deleteSlot(c *gin.Context) {
+	slot, err := a.s.DeleteSlot(c.Request.Context(), c.Param("id"), c.Param("code"))
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, slot)
+}
+
+// listCurrencies returns the currencies machines can accept.
+func (a *api) listCurrencies(c *gin.Context) {
+	c.JSON(http.StatusOK, a.currencies)
+}
+
+// changeCounts returns the count of each coin of the currency in change ordered from the
+// smallest coin.
+func (a *api) changeCounts(currency string, change models.CoinInventory) []int {
+	if a.currencies[currency] == nil {
+		return nil
+	}
+
+	return a.currencies[currency].Counts(change)
+}
+
+// machineCash returns the coins held by the cassette and the cashbox of the machine.
+func (a *api) machineCash(c *gin.Context) {
+	cash, err := a.s.MachineCash(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cash)
+}
+
+// collectCash record the coins counted out of the cashbox of the machine and empty it.
+func (a *api) collectCash(c *gin.Context) {
+	params := machineCoinsParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	collection, err := a.s.CollectCash(c.Request.Context(), c.GetString(usernameContext), c.Param("id"), params.Coins)
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, collection)
+}
+
+// topUpFloat add coins to the cassette of the machine.
+func (a *api) topUpFloat(c *gin.Context) {
+	params := machineCoinsParams{}
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	topUp, err := a.s.TopUpFloat(c.Request.Context(), c.GetString(usernameContext), c.Param("id"), params.Coins)
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, topUp)
+}
+
+func (a *api) listCashMovements(c *gin.Context) {
+	movements, err := a.s.CashMovements(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondMachineError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, movements)
+}
+
+// respondMachineError writes the response of a machine or slot request which failed with err.
+func respondMachineError(c *gin.Context, err error) {
+	if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+		respondValidationError(c, validationErr)
+		return
+	}
+
+	switch err {
+	case vendingmachine.ErrMachineNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "machine not found"})
+	case vendingmachine.ErrSlotNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "slot not found"})
+	case vendingmachine.ErrProductNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "product not found"})
+	case vendingmachine.ErrSlotExists:
+		c.JSON(http.StatusConflict, gin.H{"message": "Slot code already used in the machine"})
+	case vendingmachine.ErrCassetteFull:
+		c.JSON(http.StatusConflict, gin.H{"message": "Cassette has no room for the coins"})
+	case vendingmachine.ErrMachineNotEmpty:
+		c.JSON(http.StatusConflict, gin.H{"message": "Machine slots must be deleted first"})
+	case vendingmachine.ErrCashboxNotEmpty:
+		c.JSON(http.StatusConflict, gin.H{"message": "Machine cashbox must be collected first"})
+	case vendingmachine.ErrMachineHoldsDeposit:
+		c.JSON(http.StatusConflict, gin.H{"message": "Deposits held by the machine must be refunded first"})
+	case vendingmachine.ErrInsufficientStock:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Product quantity left is not enough to load the slot"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
+	}
+}
@@ -0,0 +1,556 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/service"
+	"github.com/bcmmbaga/vending-machine/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMachinesAndSlots(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+
+	ctx := context.Background()
+
+	operatorToken, err := api.setupOperator()
+	assert.NoError(t, err)
+
+	request := func(method, path, token string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// machines are managed by operators only.
+	rr := request(http.MethodPost, "/machines", userToken[buyer], &machineParams{Name: "station"})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/machines", operatorToken, &machineParams{Name: "station", Location: "platform 2"})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	machine := models.Machine{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&machine)
+	assert.NoError(t, err)
+	assert.Equal(t, models.MachineActive, machine.Status)
+
+	rr = request(http.MethodGet, "/machines", userToken[buyer], nil)
+	machines := []models.Machine{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&machines)
+	assert.NoError(t, err)
+	assert.Len(t, machines, 2)
+	assert.Equal(t, "lobby", machines[0].Name)
+
+	path := "/machines/" + machine.ID + "/slots"
+
+	rr = request(http.MethodPost, path, operatorToken, &slotParams{Code: "A10X", Capacity: 0, Count: 1})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	// loading a slot takes units from the product stock, 30 are left after the setup.
+	rr = request(http.MethodPost, path, operatorToken, &slotParams{Code: "b3", ProductID: productId, Capacity: 40, Count: 31})
+	assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, path, operatorToken, &slotParams{Code: "b3", ProductID: productId, Capacity: 40, Count: 20})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, path, operatorToken, &slotParams{Code: "B3", Capacity: 10})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	product, err := api.s.GetProduct(ctx, productId)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, product.Available)
+
+	count := 5
+	rr = request(http.MethodPut, path+"/B3", operatorToken, &updateSlotParams{Count: &count})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	slot := models.Slot{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&slot)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Slot{MachineID: machine.ID, Code: "B3", ProductID: productId, Capacity: 40, Count: 5}, slot)
+
+	count = 41
+	rr = request(http.MethodPut, path+"/B3", operatorToken, &updateSlotParams{Count: &count})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	product, err = api.s.GetProduct(ctx, productId)
+	assert.NoError(t, err)
+	assert.Equal(t, 25, product.Available)
+
+	// stock is per machine, buying from one machine leaves the other untouched.
+	_, err = api.s.Deposit(ctx, buyer, machine.ID, models.Coins{50})
+	assert.NoError(t, err)
+
+	rr = request(http.MethodPost, "/buy", userToken[buyer], &buyProductParams{MachineID: machine.ID, Slot: "B3", Quantity: 5})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	for id, count := range map[string]int{machine.ID: 0, machineId: 30} {
+		slots, err := api.s.Slots(ctx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, count, slots[0].Count)
+	}
+
+	// machines out of service do not sell.
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{10})
+	assert.NoError(t, err)
+
+	rr = request(http.MethodPut, "/machines/"+machineId, operatorToken, &updateMachineParams{Status: "broken"})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPut, "/machines/"+machineId, operatorToken, &updateMachineParams{Status: models.MachineMaintenance})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/buy", userToken[buyer], &buyProductParams{MachineID: machineId, Slot: "A1", Quantity: 1})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	// machines with slots cannot be deleted, deleting a slot returns its units to the stock.
+	rr = request(http.MethodDelete, "/machines/"+machineId, operatorToken, nil)
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	// products loaded in a slot cannot be deleted either.
+	rr = request(http.MethodDelete, "/product/"+productId, userToken[testUsers[1].Username], nil)
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	rr = request(http.MethodDelete, "/machines/"+machineId+"/slots/A1", operatorToken, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	product, err = api.s.GetProduct(ctx, productId)
+	assert.NoError(t, err)
+	assert.Equal(t, 55, product.Available)
+
+	rr = request(http.MethodDelete, path+"/B3", operatorToken, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	_, err = api.s.DeleteProduct(ctx, testUsers[1].Username, productId)
+	assert.NoError(t, err)
+
+	// deposits must be refunded and the cashbox collected before the machine is deleted,
+	// the coins left in the cassette are unloaded by the deletion.
+	rr = request(http.MethodPut, "/machines/"+machineId, operatorToken, &updateMachineParams{Status: models.MachineActive})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	_, err = api.s.TopUpFloat(ctx, "operator1", machineId, models.CoinInventory{20: 50})
+	assert.NoError(t, err)
+
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{20})
+	assert.NoError(t, err)
+
+	rr = request(http.MethodDelete, "/machines/"+machineId, operatorToken, nil)
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	_, err = api.s.ResetDeposit(ctx, buyer, machineId)
+	assert.NoError(t, err)
+
+	rr = request(http.MethodDelete, "/machines/"+machineId, operatorToken, nil)
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	_, err = api.s.CollectCash(ctx, "operator1", machineId, models.CoinInventory{20: 1})
+	assert.NoError(t, err)
+
+	rr = request(http.MethodDelete, "/machines/"+machineId, operatorToken, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	movements, err := api.store.ListCashMovements(ctx, machineId)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CashFloatUnload, movements[0].Kind)
+	assert.Equal(t, 49, movements[0].Coins[20])
+	assert.Equal(t, 49*20, movements[0].Amount)
+
+	cassette, err := api.store.GetCoins(ctx, models.CassetteID(machineId))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cassette.Total())
+
+	rr = request(http.MethodGet, "/machines/"+machineId, userToken[buyer], nil)
+	assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestMachineCash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	config.CassetteCapacity = 2
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+
+	ctx := context.Background()
+
+	operatorToken, err := api.setupOperator()
+	assert.NoError(t, err)
+
+	request := func(method, path, token string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	path := "/machines/" + machineId + "/cash"
+
+	rr := request(http.MethodPost, path+"/float", userToken[buyer], &machineCoinsParams{Coins: models.CoinInventory{5: 2}})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, path+"/float", operatorToken, &machineCoinsParams{Coins: models.CoinInventory{7: 1}})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, path+"/float", operatorToken, &machineCoinsParams{Coins: models.CoinInventory{5: 2, 10: 2}})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, path+"/float", operatorToken, &machineCoinsParams{Coins: models.CoinInventory{10: 1}})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	// deposited coins the cassette has no room for drop into the cashbox, change is paid out
+	// of the cassette.
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{50, 20, 20, 20})
+	assert.NoError(t, err)
+
+	order, err := api.s.Buy(ctx, buyer, machineId, "A1", 8)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CoinInventory{20: 1, 10: 1}, order.Change)
+
+	rr = request(http.MethodGet, path, operatorToken, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	cash := models.MachineCash{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&cash)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CoinInventory{5: 2, 10: 1, 20: 1, 50: 1}, cash.Cassette)
+	assert.Equal(t, models.CoinInventory{20: 1}, cash.Cashbox)
+
+	// collections empty the cashbox and record how the count compares with its content.
+	rr = request(http.MethodPost, path+"/collections", operatorToken, &machineCoinsParams{Coins: models.CoinInventory{20: 1}})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	collection := models.CashMovement{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&collection)
+	assert.NoError(t, err)
+	assert.Equal(t, "operator1", collection.Operator)
+	assert.Equal(t, 20, collection.Amount)
+	assert.Equal(t, 0, collection.Discrepancy)
+
+	rr = request(http.MethodPost, path+"/collections", operatorToken, &machineCoinsParams{Coins: models.CoinInventory{5: 1}})
+	collection = models.CashMovement{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&collection)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, collection.Discrepancy)
+
+	rr = request(http.MethodGet, path+"/movements", operatorToken, nil)
+	movements := []models.CashMovement{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&movements)
+	assert.NoError(t, err)
+	assert.Len(t, movements, 3)
+	assert.Equal(t, collection.ID, movements[0].ID)
+	assert.Equal(t, models.CashFloatTopUp, movements[2].Kind)
+
+	rr = request(http.MethodGet, "/machines/unknown/cash", operatorToken, nil)
+	assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestMachineCurrency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	config.Currencies["CHF"] = &models.Currency{Code: "CHF", Coins: []int{10, 20, 50, 100, 200, 500}, Banknotes: []int{1000, 2000}}
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer, seller := testUsers[0].Username, testUsers[1].Username
+
+	ctx := context.Background()
+
+	operatorToken, err := api.setupOperator()
+	assert.NoError(t, err)
+
+	request := func(method, path, token string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := request(http.MethodGet, "/currencies", userToken[buyer], nil)
+	currencies := models.Currencies{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&currencies)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{5, 10, 20, 50, 100}, currencies["EUR"].Coins)
+	assert.Equal(t, []int{1000, 2000}, currencies["CHF"].Banknotes)
+
+	rr = request(http.MethodPost, "/machines", operatorToken, &machineParams{Name: "station", Currency: "XYZ"})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/machines", operatorToken, &machineParams{Name: "station", Currency: "chf"})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	machine := models.Machine{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&machine)
+	assert.NoError(t, err)
+	assert.Equal(t, "CHF", machine.Currency)
+
+	// products must be payable with the denominations of the machine currency.
+	odd, err := api.s.NewProduct(ctx, seller, "odd", 5, 25)
+	assert.NoError(t, err)
+
+	path := "/machines/" + machine.ID
+	rr = request(http.MethodPost, path+"/slots", operatorToken, &slotParams{Code: "A1", ProductID: odd.ID, Capacity: 5, Count: 5})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, path+"/slots", operatorToken, &slotParams{Code: "A1", ProductID: productId, Capacity: 5, Count: 5})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	// the cost of a loaded product must stay payable in every machine holding it.
+	rr = request(http.MethodPut, "/product/"+productId, userToken[seller], &updateProductParams{Cost: 25})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	product, err := api.s.GetProduct(ctx, productId)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, product.Cost)
+
+	rr = request(http.MethodPut, "/product/"+productId, userToken[seller], &updateProductParams{Cost: -10})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPut, "/product/"+productId, userToken[seller], &updateProductParams{Available: -5})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	_, err = api.s.UpdateProduct(ctx, seller, productId, models.ProductUpdate{Available: -5})
+	assert.IsType(t, &vendingmachine.ValidationError{}, err)
+
+	rr = request(http.MethodPost, "/product", userToken[seller], &newProductParams{Name: "free", Available: 5, Cost: 0})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	_, err = api.s.NewProduct(ctx, seller, "free", 5, -5)
+	assert.IsType(t, &vendingmachine.ValidationError{}, err)
+
+	// banknotes are accepted but never used as float.
+	rr = request(http.MethodPost, path+"/cash/float", operatorToken, &machineCoinsParams{Coins: models.CoinInventory{1000: 1}})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, path+"/cash/float", operatorToken, &machineCoinsParams{Coins: models.CoinInventory{20: 2, 50: 2, 200: 2, 500: 1}})
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+
+	_, err = api.s.Deposit(ctx, buyer, machine.ID, models.Coins{5})
+	assert.Equal(t, models.ErrCoinNotAccepted, err)
+
+	_, err = api.s.Deposit(ctx, buyer, machine.ID, models.Coins{1000})
+	assert.NoError(t, err)
+
+	rr = request(http.MethodPost, "/buy", userToken[buyer], &buyProductParams{MachineID: machine.ID, Slot: "A1", Quantity: 3})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	resp := buyProductResp{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "CHF", resp.Currency)
+	assert.Equal(t, []int{0, 1, 1, 0, 2, 1}, resp.Change)
+
+	cash, err := api.s.MachineCash(ctx, machine.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.CoinInventory{1000: 1}, cash.Cashbox)
+
+	// a deposit is counted in the currency of the machine it was inserted into, it cannot be
+	// added to, spent or refunded in another currency.
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{20})
+	assert.NoError(t, err)
+
+	rr = request(http.MethodPost, "/deposit", userToken[buyer], &depositParams{MachineID: machine.ID, Coins: models.Coins{20}})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/buy", userToken[buyer], &buyProductParams{MachineID: machine.ID, Slot: "A1", Quantity: 1})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	_, err = api.s.ResetDeposit(ctx, buyer, machine.ID)
+	assert.Equal(t, vendingmachine.ErrDepositCurrency, err)
+
+	user, err := api.s.GetUser(ctx, buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, user.Deposit)
+	assert.Equal(t, "EUR", user.DepositCurrency)
+
+	// machines stored without a currency take the configured one, the deposit is not
+	// spent in the new currency when the configuration changes.
+	legacy := models.NewMachine("legacy", "", "")
+	err = api.store.CreateMachine(ctx, legacy)
+	assert.NoError(t, err)
+
+	_, err = api.s.NewSlot(ctx, legacy.ID, "A1", productId, 5, 5)
+	assert.NoError(t, err)
+
+	_, err = api.s.Deposit(ctx, seller, legacy.ID, models.Coins{20})
+	assert.NoError(t, err)
+
+	swiss := *config
+	swiss.Currency = "CHF"
+	s := service.New(api.store, notify.Discard, &swiss)
+
+	_, err = s.Buy(ctx, seller, legacy.ID, "A1", 1)
+	assert.Equal(t, vendingmachine.ErrDepositCurrency, err)
+
+	_, err = s.ResetDeposit(ctx, seller, legacy.ID)
+	assert.Equal(t, vendingmachine.ErrDepositCurrency, err)
+
+	_, err = api.s.ResetDeposit(ctx, seller, legacy.ID)
+	assert.NoError(t, err)
+
+	// sales of the same product in two currencies are earned, and paid out, apart.
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{10})
+	assert.NoError(t, err)
+
+	_, err = api.s.Buy(ctx, buyer, machineId, "A1", 1)
+	assert.NoError(t, err)
+
+	earnings, err := api.s.Earnings(ctx, seller)
+	assert.NoError(t, err)
+	assert.Len(t, earnings, 2)
+	assert.Equal(t, "CHF", earnings[0].Currency)
+	assert.Equal(t, 30, earnings[0].Balance)
+	assert.Equal(t, "EUR", earnings[1].Currency)
+	assert.Equal(t, 10, earnings[1].Balance)
+
+	rr = request(http.MethodPost, "/seller/payouts", userToken[seller], &payoutParams{})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	payout, err := api.s.Payout(ctx, seller, "EUR", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, payout[1].Amount)
+	assert.Equal(t, "EUR", payout[1].Currency)
+
+	user, err = api.s.GetUser(ctx, seller)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"CHF": 30, "EUR": 0}, user.Earnings)
+
+	_, err = api.s.Payout(ctx, seller, "EUR", 5)
+	assert.Equal(t, vendingmachine.ErrInsufficientDeposit, err)
+
+	reconciliation, err := api.s.Reconcile(ctx)
+	assert.NoError(t, err)
+	assert.True(t, reconciliation.OK())
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestDepositHeldByMachine(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+
+	ctx := context.Background()
+
+	other, err := api.s.NewMachine(ctx, "hall", "", "")
+	assert.NoError(t, err)
+
+	_, err = api.s.NewSlot(ctx, other.ID, "A1", productId, 10, 10)
+	assert.NoError(t, err)
+
+	request := func(path string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", userToken[buyer])
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{20})
+	assert.NoError(t, err)
+
+	// the coins are in the lobby machine, the deposit cannot be used or refunded elsewhere.
+	rr := request("/deposit", &depositParams{MachineID: other.ID, Coins: models.Coins{10}})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	rr = request("/buy", &buyProductParams{MachineID: other.ID, Slot: "A1", Quantity: 1})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	rr = request("/reset", &resetDepositParams{MachineID: other.ID})
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	user, err := api.s.GetUser(ctx, buyer)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, user.Deposit)
+	assert.Equal(t, machineId, user.DepositMachine)
+
+	// once refunded the next deposit may go into any machine.
+	rr = request("/reset", &resetDepositParams{MachineID: machineId})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request("/deposit", &depositParams{MachineID: other.ID, Coins: models.Coins{10}})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request("/buy", &buyProductParams{MachineID: other.ID, Slot: "A1", Quantity: 1})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+// setupOperator returns the access token of a new user holding the operator role.
+func (a *api) setupOperator() (string, error) {
+	ctx := context.Background()
+
+	_, err := a.s.NewUser(ctx, "operator1", "vending-pass1", []string{"buyer"})
+	if err != nil {
+		return "", err
+	}
+
+	operator, err := a.s.SetRoles(ctx, "@test", "operator1", []string{"operator"})
+	if err != nil {
+		return "", err
+	}
+
+	session, _, err := a.s.NewSession(ctx, operator.Username, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	return a.newAPIToken(operator, session.ID, a.config.AccessTokenTTL)
+}
@@ -4,15 +4,24 @@ import (
 	"net/http"
 	"strings"
 
+	vendingmachine "github.com/bcmmbaga/vending-machine"
 	"github.com/bcmmbaga/vending-machine/models"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// publicEndpoints are served without Authorization header.
+var publicEndpoints = map[string]bool{
+	"POST /user":                 true,
+	"POST /login":                true,
+	"POST /token/refresh":        true,
+	"POST /password/forgot":      true,
+	"POST /password/reset":       true,
+	"GET /.well-known/jwks.json": true,
+}
+
 // authenticationMiddleware validate content-type of each request is of type application/json
-// and Authotization header for all endpoint except user signin
+// and Authotization header, or X-API-Key header for API keys, for all endpoint except user signin
 func (a *api) authenticationMiddleware(c *gin.Context) {
 	contType := c.Request.Header.Get("Content-Type")
 	if (c.Request.Method == http.MethodPost || c.Request.Method == http.MethodPut) && contType != "application/json" {
@@ -22,20 +31,26 @@ func (a *api) authenticationMiddleware(c *gin.Context) {
 		return
 	}
 
-	// check for authorization header except for /user URI with POST method.
-	if (c.Request.RequestURI == "/user" && strings.ToUpper(c.Request.Method) == http.MethodPost) ||
-		(c.Request.RequestURI == "/login" && strings.ToUpper(c.Request.Method) == http.MethodPost) {
+	// check for authorization header except for public endpoints.
+	if publicEndpoints[strings.ToUpper(c.Request.Method)+" "+c.Request.URL.Path] {
 		c.Next()
+	} else if apiKey := c.Request.Header.Get(apiKeyHeader); apiKey != "" {
+		a.authenticateAPIKey(c, apiKey)
 	} else {
 		authHeader := c.Request.Header.Get("Authorization")
 
 		if authHeader != "" {
-			p := jwt.Parser{ValidMethods: []string{jwt.SigningMethodHS256.Name}}
-			token, err := p.ParseWithClaims(authHeader, &apiTokenClaims{}, func(token *jwt.Token) (interface{}, error) {
-				return []byte(a.config.Secret), nil
-			})
+			token, err := a.keys.parse(authHeader, &apiTokenClaims{})
 
 			if err != nil {
+				// expired access tokens are renewed with the refresh token of the session.
+				if validationErr, ok := err.(*jwt.ValidationError); ok && validationErr.Errors&jwt.ValidationErrorExpired != 0 {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+						"message": "Authorization token expired",
+					})
+					return
+				}
+
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
 					"message": "Invalid authorization token",
 				})
@@ -50,21 +65,24 @@ func (a *api) authenticationMiddleware(c *gin.Context) {
 				return
 			}
 
-			coll := a.db.Collection("sessions")
-			// validate session token if is active
-			session := models.Session{}
-			err = coll.FindOne(c.Request.Context(), bson.M{"username": claims.Username, "status": "active"}).Decode(&session)
+			// the session is looked up on every request, at the cost of a store round trip,
+			// so logouts, role changes and deleted accounts take effect right away instead of
+			// once the access token expires.
+			err = a.s.ValidateSession(c.Request.Context(), claims.Username, claims.Id)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Invalid session token"})
-				return
-			}
+				if err == vendingmachine.ErrInvalidSession {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Invalid session token"})
+					return
+				}
 
-			if session.Token != authHeader && session.Status == "inactive" {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Invalid session token"})
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
 				return
 			}
 
 			c.Set(usernameContext, claims.Username)
+			c.Set(sessionContext, claims.Id)
+			c.Set(rolesContext, claims.Roles)
+			c.Set(permissionsContext, claims.Permissions)
 			c.Next()
 
 		} else {
@@ -77,40 +95,77 @@ func (a *api) authenticationMiddleware(c *gin.Context) {
 
 }
 
-// buyersOnlyMiddleware check whether the user making the request has buyer's role.
-func (a *api) buyersOnlyMiddleware() gin.HandlerFunc {
-	return a.roleMiddleware("buyer")
-}
+// authenticateAPIKey authorize the request with the permissions the API key is scoped to
+// among those granted by the current roles of its user.
+func (a *api) authenticateAPIKey(c *gin.Context, key string) {
+	apiKey, user, err := a.s.AuthenticateAPIKey(c.Request.Context(), key)
+	if err != nil {
+		switch err {
+		case vendingmachine.ErrInvalidAPIKey:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid API key"})
+		case vendingmachine.ErrAccountSuspended:
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Account is suspended"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
+		}
+		return
+	}
 
-// buyersOnlyMiddleware check whether the user making the request has seller's role.
-func (a *api) sellerOnlyMiddleware() gin.HandlerFunc {
-	return a.roleMiddleware("seller")
+	c.Set(usernameContext, user.Username)
+	c.Set(apiKeyContext, apiKey.ID)
+	c.Set(rolesContext, user.Roles)
+	c.Set(permissionsContext, apiKey.Scope(a.roles.Permissions(a.grantedRoles(user))))
+	c.Next()
 }
 
-func (a *api) roleMiddleware(role string) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		username := c.GetString(usernameContext)
+// sessionOnlyMiddleware reject requests made with API keys, account management needs the
+// user to login.
+func (a *api) sessionOnlyMiddleware(c *gin.Context) {
+	if c.GetString(apiKeyContext) != "" {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "API keys cannot access this endpoint"})
+		return
+	}
 
-		user := models.User{}
+	c.Next()
+}
 
-		coll := a.db.Collection("users")
-		err := coll.FindOne(c.Request.Context(), bson.M{"username": username}).Decode(&user)
-		if err != nil {
-			if err == mongo.ErrNoDocuments {
-				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Account not found"})
+// permissionMiddleware check whether the token making the request grants the permission.
+func (a *api) permissionMiddleware(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, granted := range c.GetStringSlice(permissionsContext) {
+			if granted == permission {
+				c.Next()
 				return
 			}
-
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
-			return
 		}
 
-		ok := user.HasRole(role)
-		if !ok {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Account permission failed"})
-			return
+		// seller permissions are withheld until the seller enable two-factor authentication.
+		if a.config.SellerTOTPRequired && a.roles.Grants("seller", permission) {
+			for _, role := range c.GetStringSlice(rolesContext) {
+				if role == "seller" {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Two-factor authentication must be enabled for seller accounts"})
+					return
+				}
+			}
 		}
 
-		c.Next()
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Account permission failed"})
 	}
 }
+
+// grantedRoles returns the roles whose permissions are granted to the user, the seller role
+// is left out while SellerTOTPRequired and the user has not enabled two-factor authentication.
+func (a *api) grantedRoles(user *models.User) []string {
+	if !a.config.SellerTOTPRequired || user.TOTP.Enabled {
+		return user.Roles
+	}
+
+	roles := []string{}
+	for _, role := range user.Roles {
+		if role != "seller" {
+			roles = append(roles, role)
+		}
+	}
+
+	return roles
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/gin-gonic/gin"
+)
+
+// ListOrders returns a page of the buyer purchase history newest first.
+func (a *api) ListOrders(c *gin.Context) {
+	params := listOrdersParams{}
+
+	err := c.ShouldBindQuery(&params)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query params"})
+		return
+	}
+
+	page, err := a.s.Orders(c.Request.Context(), c.GetString(usernameContext), params.Cursor, params.Limit)
+	if err != nil {
+		if err == vendingmachine.ErrInvalidCursor {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to list orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetOrder returns the receipt of a single purchase made by the buyer.
+func (a *api) GetOrder(c *gin.Context) {
+	orderId, ok := c.Params.Get("id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing orderId in URI param"})
+		return
+	}
+
+	order, err := a.s.Order(c.Request.Context(), c.GetString(usernameContext), orderId)
+	if err != nil {
+		if err == vendingmachine.ErrOrderNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "order not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// GetCheckout returns the receipt of a checkout made by the buyer, with the change paid for
+// the whole cart.
+func (a *api) GetCheckout(c *gin.Context) {
+	checkout, err := a.s.CheckoutReceipt(c.Request.Context(), c.GetString(usernameContext), c.Param("id"))
+	if err != nil {
+		if err == vendingmachine.ErrCheckoutNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"message": "checkout not found"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get checkout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkout)
+}
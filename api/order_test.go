@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	config.VendMode = vendingmachine.VendModeWallet
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+
+	_, err = api.s.Deposit(context.Background(), buyer, machineId, models.Coins{100})
+	assert.NoError(t, err)
+
+	placed := []string{}
+	for i := 1; i <= 3; i++ {
+		order, err := api.s.Buy(context.Background(), buyer, machineId, "A1", i)
+		assert.NoError(t, err)
+
+		placed = append([]string{order.ID}, placed...)
+
+		// keep order timestamps distinct so the newest first order is deterministic.
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	listed := []string{}
+	cursor := ""
+	for {
+		rr := httptest.NewRecorder()
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/orders?limit=2&cursor=%s", cursor), nil)
+		req.Header.Set("Authorization", userToken[buyer])
+		assert.NoError(t, err)
+
+		api.handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		page := models.OrderPage{}
+		err = json.NewDecoder(rr.Result().Body).Decode(&page)
+		assert.NoError(t, err)
+
+		for _, order := range page.Orders {
+			listed = append(listed, order.ID)
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+
+		cursor = page.NextCursor
+	}
+
+	assert.Equal(t, placed, listed)
+
+	testCases := []struct {
+		orderID      string
+		username     string
+		responseCode int
+	}{
+		{
+			orderID:      placed[0],
+			username:     buyer,
+			responseCode: 200,
+		},
+		{
+			orderID:      "unknown",
+			username:     buyer,
+			responseCode: 404,
+		},
+		{
+			orderID:      placed[0],
+			username:     testUsers[1].Username,
+			responseCode: 403,
+		},
+	}
+
+	for _, test := range testCases {
+		rr := httptest.NewRecorder()
+
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("/orders/%s", test.orderID), nil)
+		req.Header.Set("Authorization", userToken[test.username])
+		assert.NoError(t, err)
+
+		api.handler.ServeHTTP(rr, req)
+
+		if rr.Result().StatusCode == http.StatusOK {
+			order := models.Order{}
+			err = json.NewDecoder(rr.Result().Body).Decode(&order)
+			assert.NoError(t, err)
+
+			assert.Equal(t, test.orderID, order.ID)
+			assert.Equal(t, 3, order.Quantity)
+			assert.Equal(t, 10, order.UnitCost)
+			assert.Equal(t, 30, order.Total)
+			assert.Equal(t, 40, order.Balance)
+		} else {
+			assert.Equal(t, test.responseCode, rr.Result().StatusCode)
+		}
+	}
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/gin-gonic/gin"
+)
+
+type changePasswordParams struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+}
+
+type forgotPasswordParams struct {
+	Username string `json:"username"`
+}
+
+type resetPasswordParams struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"newPassword"`
+}
+
+// changePassword replace the password of the user making the request, every other session
+// of the user is logged out.
+func (a *api) changePassword(c *gin.Context) {
+	params := changePasswordParams{}
+
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	err := a.s.ChangePassword(c.Request.Context(), c.GetString(usernameContext), params.OldPassword, params.NewPassword, c.GetString(sessionContext))
+	if err != nil {
+		if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+			respondValidationError(c, validationErr)
+			return
+		}
+
+		switch err {
+		case vendingmachine.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		case vendingmachine.ErrInvalidCredentials:
+			c.JSON(http.StatusForbidden, gin.H{"message": "Old password is incorrect"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to change password"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
+
+// forgotPassword send a password reset token to the user, the response is the same
+// whether the username exists or not.
+func (a *api) forgotPassword(c *gin.Context) {
+	params := forgotPasswordParams{}
+
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	err := a.s.ForgotPassword(c.Request.Context(), params.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to send password reset token"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "A password reset token has been sent if the account exists"})
+}
+
+// resetPassword set a new password with a password reset token.
+func (a *api) resetPassword(c *gin.Context) {
+	params := resetPasswordParams{}
+
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	err := a.s.ResetPassword(c.Request.Context(), params.Token, params.NewPassword)
+	if err != nil {
+		if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+			respondValidationError(c, validationErr)
+			return
+		}
+
+		switch err {
+		case vendingmachine.ErrInvalidResetToken:
+			c.JSON(http.StatusForbidden, gin.H{"message": "Password reset token is invalid or expired"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to reset password"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
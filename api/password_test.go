@@ -0,0 +1,120 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordChangeAndReset(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	config.NotifierLogFile = filepath.Join(t.TempDir(), "notifications.log")
+
+	// logins with the old password fail, do not throttle the following ones.
+	config.LoginMaxFailures = 0
+
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+
+	request := func(method, path, token string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	logIn := func(password string) string {
+		rr := request(http.MethodPost, "/login", "", &logInParams{Username: buyer, Password: password})
+		if rr.Result().StatusCode != http.StatusOK {
+			return ""
+		}
+
+		resp := tokenResp{}
+		_ = json.NewDecoder(rr.Result().Body).Decode(&resp)
+		return resp.Token
+	}
+
+	other := logIn("vending-pass1")
+	assert.NotEmpty(t, other)
+
+	rr := request(http.MethodPut, "/user/password", userToken[buyer], &changePasswordParams{OldPassword: "wrong", NewPassword: "changed-pass2"})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPut, "/user/password", userToken[buyer], &changePasswordParams{OldPassword: "vending-pass1", NewPassword: "changed-pass2"})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	// the session changing the password stays logged in, the others are logged out.
+	rr = request(http.MethodGet, "/user", userToken[buyer], nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/user", other, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	assert.Empty(t, logIn("vending-pass1"))
+	assert.NotEmpty(t, logIn("changed-pass2"))
+
+	for _, username := range []string{"unknown", buyer} {
+		rr = request(http.MethodPost, "/password/forgot", "", &forgotPasswordParams{Username: username})
+		assert.Equal(t, http.StatusAccepted, rr.Result().StatusCode)
+	}
+
+	f, err := os.Open(config.NotifierLogFile)
+	assert.NoError(t, err)
+
+	notifications := []notify.Notification{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		notification := notify.Notification{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &notification))
+		notifications = append(notifications, notification)
+	}
+	f.Close()
+
+	// nothing is sent for unknown usernames.
+	assert.Len(t, notifications, 1)
+	assert.Equal(t, buyer, notifications[0].To)
+	token := notifications[0].Data["token"]
+
+	rr = request(http.MethodPost, "/password/reset", "", &resetPasswordParams{Token: "unknown", NewPassword: "reset-pass3"})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/password/reset", "", &resetPasswordParams{Token: token, NewPassword: "reset-pass3"})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	// reset tokens are single-use.
+	rr = request(http.MethodPost, "/password/reset", "", &resetPasswordParams{Token: token, NewPassword: "reset-pass4"})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/user", userToken[buyer], nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	assert.NotEmpty(t, logIn("reset-pass3"))
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
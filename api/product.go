@@ -1,34 +1,30 @@
 package api
 
 import (
-	"encoding/json"
-	"fmt"
 	"net/http"
+	"strings"
 
+	vendingmachine "github.com/bcmmbaga/vending-machine"
 	"github.com/bcmmbaga/vending-machine/models"
-	"github.com/fatih/structs"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func (a *api) NewProduct(c *gin.Context) {
 	params := newProductParams{}
 
-	err := c.BindJSON(&params)
-	if err != nil {
-		if syntaxError, ok := err.(*json.SyntaxError); ok {
-			c.JSON(http.StatusBadRequest, syntaxError)
-			return
-		}
+	if !bindJSON(c, &params) {
+		return
 	}
 
 	seller := c.GetString(usernameContext)
-	product := models.NewProduct(params.Name, params.Available, params.Cost, seller)
 
-	coll := a.db.Collection("products")
-	_, err = coll.InsertOne(c.Request.Context(), product)
+	product, err := a.s.NewProduct(c.Request.Context(), seller, params.Name, params.Available, params.Cost)
 	if err != nil {
+		if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+			respondValidationError(c, validationErr)
+			return
+		}
+
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create new Product"})
 		return
 	}
@@ -44,12 +40,9 @@ func (a *api) GetProduct(c *gin.Context) {
 		return
 	}
 
-	product := models.Product{}
-
-	coll := a.db.Collection("products")
-	err := coll.FindOne(c.Request.Context(), bson.M{"_id": productId}).Decode(&product)
+	product, err := a.s.GetProduct(c.Request.Context(), productId)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == vendingmachine.ErrProductNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"message": "product not found"})
 			return
 		}
@@ -61,54 +54,76 @@ func (a *api) GetProduct(c *gin.Context) {
 	c.JSON(http.StatusOK, product)
 }
 
-func (a *api) UpdateProduct(c *gin.Context) {
-	productId, ok := c.Params.Get("id")
-	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing productId in URI param"})
-		return
-	}
-
-	params := updateProductParams{}
+// ListProducts returns a page of the product catalog, the nextCursor of a page is passed as
+// cursor query param to get the next one.
+func (a *api) ListProducts(c *gin.Context) {
+	params := listProductsParams{}
 
-	err := c.BindJSON(&params)
+	err := c.ShouldBindQuery(&params)
 	if err != nil {
-		if syntaxError, ok := err.(*json.SyntaxError); ok {
-			c.JSON(http.StatusBadRequest, syntaxError)
-			return
-		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query params"})
+		return
 	}
 
-	product := models.Product{}
-	coll := a.db.Collection("products")
+	query := models.ProductQuery{
+		SellerID:   params.Seller,
+		MinCost:    params.MinCost,
+		MaxCost:    params.MaxCost,
+		InStock:    params.InStock,
+		Search:     params.Search,
+		SortBy:     strings.TrimPrefix(params.Sort, "-"),
+		Descending: strings.HasPrefix(params.Sort, "-"),
+		Limit:      params.Limit,
+	}
 
-	err = coll.FindOne(c.Request.Context(), bson.M{"_id": productId}).Decode(&product)
+	page, err := a.s.ListProducts(c.Request.Context(), query, params.Cursor)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"message": "product not found"})
-			return
+		switch err {
+		case vendingmachine.ErrInvalidProductQuery:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid query params"})
+		case vendingmachine.ErrInvalidCursor:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid cursor"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to list products"})
 		}
-
-		c.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if product.SellerId != c.GetString(usernameContext) {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Failed to update product not product owner"})
+	c.JSON(http.StatusOK, page)
+}
+
+func (a *api) UpdateProduct(c *gin.Context) {
+	productId, ok := c.Params.Get("id")
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Missing productId in URI param"})
 		return
 	}
 
-	updateQuery := bson.M{}
-	paramsMap := structs.Map(&params)
+	params := updateProductParams{}
 
-	for key := range paramsMap {
-		if value := paramsMap[key]; value != "" && value != 0 && value != 0.0 {
-			updateQuery[key] = value
-		}
+	if !bindJSON(c, &params) {
+		return
 	}
 
-	_, err = coll.UpdateOne(c.Request.Context(), bson.M{"_id": productId}, bson.M{"$set": updateQuery})
+	_, err := a.s.UpdateProduct(c.Request.Context(), c.GetString(usernameContext), productId, models.ProductUpdate{
+		Name:      params.Name,
+		Available: params.Available,
+		Cost:      params.Cost,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update product"})
+		if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+			respondValidationError(c, validationErr)
+			return
+		}
+
+		switch err {
+		case vendingmachine.ErrProductNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "product not found"})
+		case vendingmachine.ErrNotProductOwner:
+			c.JSON(http.StatusForbidden, gin.H{"message": "Failed to update product not product owner"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to update product"})
+		}
 		return
 	}
 
@@ -123,28 +138,18 @@ func (a *api) DeleteProduct(c *gin.Context) {
 		return
 	}
 
-	product := models.Product{}
-	coll := a.db.Collection("products")
-
-	err := coll.FindOne(c.Request.Context(), bson.M{"_id": productId}).Decode(&product)
+	product, err := a.s.DeleteProduct(c.Request.Context(), c.GetString(usernameContext), productId)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		switch err {
+		case vendingmachine.ErrProductNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"message": "product not found"})
-			return
+		case vendingmachine.ErrNotProductOwner:
+			c.JSON(http.StatusForbidden, gin.H{"message": "Failed to delete product not product owner"})
+		case vendingmachine.ErrProductInSlots:
+			c.JSON(http.StatusConflict, gin.H{"message": "Product is still loaded in machine slots, unload them first"})
+		default:
+			c.JSON(http.StatusInternalServerError, "Failed to delete product")
 		}
-
-		c.JSON(http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	if product.SellerId != c.GetString(usernameContext) {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Failed to delete product not product owner"})
-		return
-	}
-
-	err = coll.FindOneAndDelete(c.Request.Context(), bson.M{"_id": productId}).Decode(&product)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, "Failed to delete product")
 		return
 	}
 
@@ -154,94 +159,107 @@ func (a *api) DeleteProduct(c *gin.Context) {
 func (a *api) buyProduct(c *gin.Context) {
 	params := buyProductParams{}
 
-	err := c.BindJSON(&params)
-	if err != nil {
-		if syntaxError, ok := err.(*json.SyntaxError); ok {
-			c.JSON(http.StatusBadRequest, syntaxError)
-			return
-		}
+	if !bindJSON(c, &params) {
+		return
 	}
 
-	productColl := a.db.Collection("products")
-
-	product := models.Product{}
-	err = productColl.FindOne(c.Request.Context(), bson.M{"_id": params.ProductID}).Decode(&product)
+	order, err := a.s.Buy(c.Request.Context(), c.GetString(usernameContext), params.MachineID, params.Slot, params.Quantity)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"message": "product not found"})
+		if err == vendingmachine.ErrInvalidQuantity {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Product quantity must be greater than zero"})
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	// check if products is available depending on buyer quantity
-	if params.Quantity > product.Available {
-		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Product quantity left is %d", product.Available)})
+		respondPurchaseError(c, err)
 		return
 	}
 
-	buyer := models.User{}
-	username := c.GetString(usernameContext)
-	usersColl := a.db.Collection("users")
+	c.JSON(http.StatusOK, &buyProductResp{
+		OrderID:         order.ID,
+		TotalSpent:      order.Total,
+		ProductName:     order.Product.Name,
+		ProductQuantity: order.Quantity,
+		MachineID:       order.MachineID,
+		Slot:            order.Slot,
+		Currency:        order.Currency,
+		Change:          a.changeCounts(order.Currency, order.Change),
+		Deposit:         order.Balance,
+	})
+}
 
-	err = usersColl.FindOne(c.Request.Context(), bson.M{"username": username}).Decode(&buyer)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Buyer not found"})
-			return
-		}
+// checkout buy every item of the cart at once, the change of the whole cart is paid once.
+func (a *api) checkout(c *gin.Context) {
+	params := checkoutParams{}
 
-		c.JSON(http.StatusInternalServerError, err.Error())
+	if !bindJSON(c, &params) {
 		return
 	}
 
-	seller := models.User{}
-	err = usersColl.FindOne(c.Request.Context(), bson.M{"username": product.SellerId}).Decode(&seller)
+	items := make([]models.CartItem, len(params.Items))
+	for i, item := range params.Items {
+		items[i] = models.CartItem{Slot: item.Slot, Quantity: item.Quantity}
+	}
+
+	checkout, err := a.s.Checkout(c.Request.Context(), c.GetString(usernameContext), params.MachineID, items)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			c.JSON(http.StatusNotFound, gin.H{"message": "Seller not found"})
-			return
+		switch err {
+		case vendingmachine.ErrEmptyCart, vendingmachine.ErrInvalidQuantity:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Every item must have a quantity greater than zero"})
+		default:
+			respondPurchaseError(c, err)
 		}
-
-		c.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	totalAmount := params.Quantity * product.Cost
-	if totalAmount > buyer.Deposit {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Deposit balance is not enough, please make deposit to complete the purchase"})
-		return
+	resp := &checkoutResp{
+		CheckoutID: checkout.ID,
+		TotalSpent: checkout.Total,
+		Currency:   checkout.Currency,
+		Change:     a.changeCounts(checkout.Currency, checkout.Change),
+		Deposit:    checkout.Balance,
 	}
 
-	// deduce totalAMount from buyer's deposit wallet
-	_, err = usersColl.UpdateOne(c.Request.Context(), bson.M{"username": buyer.Username}, bson.M{"$set": bson.M{"deposit": buyer.Deposit - totalAmount}})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
-		return
+	for _, order := range checkout.Items {
+		resp.Items = append(resp.Items, checkoutItemResp{
+			OrderID:         order.ID,
+			ProductID:       order.Product.ID,
+			ProductName:     order.Product.Name,
+			ProductQuantity: order.Quantity,
+			Slot:            order.Slot,
+			UnitCost:        order.UnitCost,
+			Total:           order.Total,
+		})
 	}
 
-	// credit the amount to seller deposit account
-	_, err = usersColl.UpdateOne(c.Request.Context(), bson.M{"username": seller.Username}, bson.M{"$set": bson.M{"deposit": seller.Deposit + totalAmount}})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
-		return
-	}
+	c.JSON(http.StatusOK, resp)
+}
 
-	// update available product quantity after purchase
-	_, err = productColl.UpdateOne(c.Request.Context(), bson.M{"_id": params.ProductID}, bson.M{"$set": bson.M{"available": product.Available - params.Quantity}})
-	if err != nil {
+// respondPurchaseError writes the response of a purchase which failed with err.
+func respondPurchaseError(c *gin.Context, err error) {
+	switch err {
+	case vendingmachine.ErrMachineNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "machine not found"})
+	case vendingmachine.ErrSlotNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "slot not found"})
+	case vendingmachine.ErrProductNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "product not found"})
+	case vendingmachine.ErrUserNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "Buyer not found"})
+	case vendingmachine.ErrSellerNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"message": "Seller not found"})
+	case vendingmachine.ErrMachineUnavailable:
+		c.JSON(http.StatusConflict, gin.H{"message": "Machine is not active"})
+	case vendingmachine.ErrSlotEmpty, vendingmachine.ErrInsufficientStock:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Product quantity left is not enough to complete the purchase"})
+	case vendingmachine.ErrInsufficientDeposit:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Deposit balance is not enough, please make deposit to complete the purchase"})
+	case vendingmachine.ErrDepositElsewhere:
+		c.JSON(http.StatusConflict, gin.H{"message": "Deposit is held by another machine, spend or reset it there first"})
+	case vendingmachine.ErrDepositCurrency:
+		c.JSON(http.StatusConflict, gin.H{"message": "Deposit is in another currency than the machine"})
+	case models.ErrExactChangeUnavailable:
+		c.JSON(http.StatusConflict, gin.H{"message": "Exact change cannot be made, please deposit smaller coins"})
+	default:
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the request"})
-		return
 	}
-
-	change, _ := product.Change(params.Quantity, buyer.Deposit)
-
-	c.JSON(http.StatusOK, &buyProductResp{
-		TotalSpent:      totalAmount,
-		ProductName:     product.Name,
-		ProductQuantity: params.Quantity,
-		Change:          change,
-	})
 }
@@ -0,0 +1,254 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListProducts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	seller := testUsers[1].Username
+
+	for _, p := range []struct {
+		name      string
+		available int
+		cost      int
+	}{
+		{"Cola", 5, 45},
+		{"cola zero", 0, 50},
+		{"Chips", 12, 25},
+		{"Water", 8, 15},
+	} {
+		_, err := api.s.NewProduct(context.Background(), seller, p.name, p.available, p.cost)
+		assert.NoError(t, err)
+	}
+
+	testCases := []struct {
+		query        url.Values
+		responseCode int
+		names        []string
+	}{
+		{
+			query:        url.Values{"sort": {"cost"}, "limit": {"2"}},
+			responseCode: 200,
+			names:        []string{"testing", "Water", "Chips", "Cola", "cola zero"},
+		},
+		{
+			query:        url.Values{"sort": {"-available"}, "limit": {"3"}, "inStock": {"true"}},
+			responseCode: 200,
+			names:        []string{"testing", "Chips", "Water", "Cola"},
+		},
+		{
+			query:        url.Values{"q": {"COLA"}, "maxCost": {"45"}},
+			responseCode: 200,
+			names:        []string{"Cola"},
+		},
+		{
+			query:        url.Values{"seller": {"unknown"}},
+			responseCode: 200,
+			names:        []string{},
+		},
+		{
+			query:        url.Values{"sort": {"seller"}},
+			responseCode: 400,
+		},
+		{
+			query:        url.Values{"cursor": {"not-a-cursor"}},
+			responseCode: 400,
+		},
+	}
+
+	for _, test := range testCases {
+		names := []string{}
+		cursor := ""
+
+		for {
+			query := url.Values{}
+			for key, value := range test.query {
+				query[key] = value
+			}
+
+			if cursor != "" {
+				query.Set("cursor", cursor)
+			}
+
+			rr := httptest.NewRecorder()
+
+			req, err := http.NewRequest(http.MethodGet, "/product?"+query.Encode(), nil)
+			req.Header.Set("Authorization", userToken[testUsers[0].Username])
+			assert.NoError(t, err)
+
+			api.handler.ServeHTTP(rr, req)
+
+			assert.Equal(t, test.responseCode, rr.Result().StatusCode)
+			if rr.Result().StatusCode != http.StatusOK {
+				break
+			}
+
+			page := models.ProductPage{}
+			err = json.NewDecoder(rr.Result().Body).Decode(&page)
+			assert.NoError(t, err)
+
+			for _, product := range page.Products {
+				names = append(names, product.Name)
+			}
+
+			if page.NextCursor == "" {
+				break
+			}
+
+			cursor = page.NextCursor
+		}
+
+		if test.responseCode == http.StatusOK {
+			assert.Equal(t, test.names, names)
+		}
+	}
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestCheckout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer, seller := testUsers[0].Username, testUsers[1].Username
+
+	ctx := context.Background()
+
+	snack, err := api.s.NewProduct(ctx, seller, "snack", 2, 25)
+	assert.NoError(t, err)
+
+	_, err = api.s.NewSlot(ctx, machineId, "B2", snack.ID, 5, 2)
+	assert.NoError(t, err)
+
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{50, 20, 20, 10})
+	assert.NoError(t, err)
+
+	checkout := func(items ...checkoutItemParams) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(&checkoutParams{MachineID: machineId, Items: items})
+		req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", userToken[buyer])
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assertUntouched := func() {
+		user, err := api.s.GetUser(ctx, buyer)
+		assert.NoError(t, err)
+		assert.Equal(t, 100, user.Deposit)
+
+		for code, count := range map[string]int{"A1": 30, "B2": 2} {
+			slot, err := api.s.GetSlot(ctx, machineId, code)
+			assert.NoError(t, err)
+			assert.Equal(t, count, slot.Count)
+		}
+	}
+
+	// a single item failing rejects the whole cart.
+	rr := checkout(checkoutItemParams{Slot: "A1", Quantity: 1}, checkoutItemParams{Slot: "B2", Quantity: 3})
+	assert.Equal(t, http.StatusBadRequest, rr.Result().StatusCode)
+	assertUntouched()
+
+	rr = checkout(checkoutItemParams{Slot: "A1", Quantity: 6}, checkoutItemParams{Slot: "B2", Quantity: 2})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+	assertUntouched()
+
+	rr = checkout(checkoutItemParams{Slot: "A1", Quantity: 1}, checkoutItemParams{Slot: "C9", Quantity: 1})
+	assert.Equal(t, http.StatusNotFound, rr.Result().StatusCode)
+	assertUntouched()
+
+	rr = checkout()
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	rr = checkout(checkoutItemParams{Slot: "A1", Quantity: 0})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+
+	// items of the same slot are merged, the change is paid once for the cart.
+	rr = checkout(
+		checkoutItemParams{Slot: "A1", Quantity: 2},
+		checkoutItemParams{Slot: "B2", Quantity: 2},
+		checkoutItemParams{Slot: "A1", Quantity: 1},
+	)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	resp := checkoutResp{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&resp)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 80, resp.TotalSpent)
+	assert.Equal(t, []int{0, 0, 1, 0, 0}, resp.Change)
+	assert.Equal(t, 0, resp.Deposit)
+	assert.Len(t, resp.Items, 2)
+	assert.Equal(t, checkoutItemResp{OrderID: resp.Items[0].OrderID, ProductID: productId, ProductName: "testing", ProductQuantity: 3, Slot: "A1", UnitCost: 10, Total: 30}, resp.Items[0])
+	assert.Equal(t, 50, resp.Items[1].Total)
+
+	// line items are listed in the buyer orders.
+	order, err := api.s.Order(ctx, buyer, resp.Items[1].OrderID)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.CheckoutID, order.CheckoutID)
+
+	// the checkout is kept with the change paid for the cart, which its refund refers to.
+	rr = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/checkout/"+resp.CheckoutID, nil)
+	req.Header.Set("Authorization", userToken[buyer])
+	api.handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	stored := models.Checkout{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&stored)
+	assert.NoError(t, err)
+	assert.Equal(t, 80, stored.Total)
+	assert.Equal(t, 20, stored.Change.Total())
+	assert.Len(t, stored.Items, 2)
+
+	entries, err := api.store.LedgerEntries(ctx, buyer)
+	assert.NoError(t, err)
+	refunded := false
+	for _, entry := range entries {
+		if entry.Kind == models.LedgerRefund {
+			assert.Equal(t, resp.CheckoutID, entry.OrderID)
+			refunded = true
+		}
+	}
+	assert.True(t, refunded)
+
+	_, err = api.s.CheckoutReceipt(ctx, seller, resp.CheckoutID)
+	assert.Equal(t, vendingmachine.ErrCheckoutNotFound, err)
+
+	earnings, err := api.s.Earnings(ctx, seller)
+	assert.NoError(t, err)
+	assert.Len(t, earnings, 1)
+	assert.Equal(t, "EUR", earnings[0].Currency)
+	assert.Equal(t, 80, earnings[0].Balance)
+
+	reconciliation, err := api.s.Reconcile(ctx)
+	assert.NoError(t, err)
+	assert.True(t, reconciliation.OK())
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"net/http"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/gin-gonic/gin"
+)
+
+// earnings returns the seller balance in each currency with sales totals per product and
+// per day.
+func (a *api) earnings(c *gin.Context) {
+	earnings, err := a.s.Earnings(c.Request.Context(), c.GetString(usernameContext))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to compute earnings"})
+		return
+	}
+
+	c.JSON(http.StatusOK, earnings)
+}
+
+// payout withdraw the requested amount, or the whole balance when omitted, from the seller
+// balance in the requested currency.
+func (a *api) payout(c *gin.Context) {
+	params := payoutParams{}
+
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	entry, err := a.s.Payout(c.Request.Context(), c.GetString(usernameContext), params.Currency, params.Amount)
+	if err != nil {
+		if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+			respondValidationError(c, validationErr)
+			return
+		}
+
+		switch err {
+		case vendingmachine.ErrInvalidAmount:
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Payout amount must be greater than zero"})
+		case vendingmachine.ErrInsufficientDeposit:
+			c.JSON(http.StatusForbidden, gin.H{"message": "Balance is not enough to complete the payout"})
+		case vendingmachine.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "Seller not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process the payout"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSellerEarningsAndPayouts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer, seller := testUsers[0].Username, testUsers[1].Username
+
+	for quantity, coins := range map[int]models.Coins{2: {20}, 3: {10, 20}} {
+		_, err = api.s.Deposit(context.Background(), buyer, machineId, coins)
+		assert.NoError(t, err)
+
+		_, err = api.s.Buy(context.Background(), buyer, machineId, "A1", quantity)
+		assert.NoError(t, err)
+	}
+
+	testCases := []struct {
+		body         string
+		responseCode int
+		balance      int
+	}{
+		{
+			body:         `{"amount": 20}`,
+			responseCode: 422,
+			balance:      50,
+		},
+		{
+			body:         `{"currency": "EUR", "amount": 20}`,
+			responseCode: 201,
+			balance:      30,
+		},
+		{
+			body:         `{"currency": "EUR", "amount": 40}`,
+			responseCode: 403,
+			balance:      30,
+		},
+		{
+			body:         `{"currency": "EUR", "amount": -10}`,
+			responseCode: 422,
+			balance:      30,
+		},
+		{
+			body:         `{"currency": "CHF"}`,
+			responseCode: 403,
+			balance:      30,
+		},
+		{
+			body:         `{"currency": "eur"}`,
+			responseCode: 201,
+			balance:      0,
+		},
+		{
+			body:         `{"currency": "EUR"}`,
+			responseCode: 403,
+			balance:      0,
+		},
+	}
+
+	for _, test := range testCases {
+		rr := httptest.NewRecorder()
+
+		req, err := http.NewRequest(http.MethodPost, "/seller/payouts", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", userToken[seller])
+		assert.NoError(t, err)
+
+		api.handler.ServeHTTP(rr, req)
+		assert.Equal(t, test.responseCode, rr.Result().StatusCode)
+
+		rr = httptest.NewRecorder()
+
+		req, err = http.NewRequest(http.MethodGet, "/seller/earnings", nil)
+		req.Header.Set("Authorization", userToken[seller])
+		assert.NoError(t, err)
+
+		api.handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		earnings := []models.Earnings{}
+		err = json.NewDecoder(rr.Result().Body).Decode(&earnings)
+		assert.NoError(t, err)
+		assert.Len(t, earnings, 1)
+
+		assert.Equal(t, "EUR", earnings[0].Currency)
+		assert.Equal(t, test.balance, earnings[0].Balance)
+		assert.Equal(t, 50, earnings[0].TotalSales)
+		assert.Equal(t, 50-test.balance, earnings[0].TotalPayouts)
+
+		assert.Len(t, earnings[0].Products, 1)
+		assert.Equal(t, 5, earnings[0].Products[0].Quantity)
+		assert.Equal(t, 50, earnings[0].Products[0].Amount)
+
+		assert.Len(t, earnings[0].Days, 1)
+		assert.Equal(t, 50, earnings[0].Days[0].Amount)
+
+		user, err := api.s.GetUser(context.Background(), seller)
+		assert.NoError(t, err)
+		assert.Equal(t, test.balance, user.Earnings["EUR"])
+		assert.Equal(t, 0, user.Deposit)
+	}
+
+	// earnings are reserved to sellers.
+	rr := httptest.NewRecorder()
+
+	req, err := http.NewRequest(http.MethodGet, "/seller/earnings", nil)
+	req.Header.Set("Authorization", userToken[buyer])
+	assert.NoError(t, err)
+
+	api.handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
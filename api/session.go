@@ -1,102 +1,148 @@
 package api
 
 import (
-	"encoding/json"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
+	vendingmachine "github.com/bcmmbaga/vending-machine"
 	"github.com/bcmmbaga/vending-machine/models"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type apiTokenClaims struct {
 	jwt.StandardClaims
 	Username string `json:"username"`
+
+	// Roles and Permissions are granted when the token is issued so requests are
+	// authorized without looking the user up.
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
 }
 
 type logInParams struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+
+	// OTP is a TOTP or recovery code, required for users with two-factor authentication.
+	OTP string `json:"otp,omitempty"`
+}
+
+type refreshTokenParams struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type tokenResp struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
 }
 
 func (a *api) logIn(c *gin.Context) {
 	params := logInParams{}
-	err := c.BindJSON(&params)
-	if err != nil {
-		if syntaxError, ok := err.(*json.SyntaxError); ok {
-			c.JSON(http.StatusBadRequest, syntaxError)
-			return
-		}
+	if !bindJSON(c, &params) {
+		return
 	}
 
-	user := models.User{}
-	coll := a.db.Collection("users")
-
-	res := coll.FindOne(c.Request.Context(), bson.M{"username": params.Username})
-	err = res.Decode(&user)
+	user, err := a.s.Authenticate(c.Request.Context(), params.Username, params.Password, params.OTP, c.ClientIP())
 	if err != nil {
-		if res.Err() == mongo.ErrNoDocuments {
+		switch err {
+		case vendingmachine.ErrInvalidCredentials:
 			c.JSON(http.StatusForbidden, gin.H{"message": "Account username/password is incorrect"})
 			return
+		case vendingmachine.ErrOTPRequired:
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "One-time password required", "otpRequired": true})
+			return
+		case vendingmachine.ErrInvalidOTP:
+			c.JSON(http.StatusForbidden, gin.H{"message": "One-time password is incorrect"})
+			return
+		case vendingmachine.ErrAccountSuspended:
+			c.JSON(http.StatusForbidden, gin.H{"message": "Account is suspended"})
+			return
+		}
+
+		if lockedErr, ok := err.(*vendingmachine.LoginLockedError); ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(lockedErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"message": "Too many failed login attempts, please retry later"})
+			return
 		}
 
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Unexpected error occured"})
 		return
 	}
 
-	authenticated := user.Authenticate(params.Password)
+	session, refreshToken, err := a.s.NewSession(c.Request.Context(), user.Username, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInsufficientStorage, gin.H{"message": "Failed to save session"})
+		return
+	}
 
-	if !authenticated {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Account username/password is incorrect"})
+	a.respondTokens(c, session.Username, session.ID, refreshToken)
+}
+
+// refreshToken exchange a refresh token for a new access token and refresh token.
+func (a *api) refreshToken(c *gin.Context) {
+	params := refreshTokenParams{}
+	if !bindJSON(c, &params) {
 		return
 	}
 
-	token, err := newAPIToken(user.Username, a.config.Secret)
+	session, refreshToken, err := a.s.RefreshSession(c.Request.Context(), params.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to initiate session token"})
+		switch err {
+		case vendingmachine.ErrInvalidRefreshToken:
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		case vendingmachine.ErrRefreshTokenReused:
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Refresh token already used, the session has been revoked"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to refresh session token"})
+		}
 		return
 	}
 
-	session := models.NewSession(params.Username, token)
-	coll = a.db.Collection("sessions")
-
-	// check if there is any active session for this user
-	res = coll.FindOne(c.Request.Context(), bson.M{"username": params.Username, "status": "active"})
-	if err := res.Err(); err != nil {
-		if err == mongo.ErrNoDocuments {
-			_, err = coll.InsertOne(c.Request.Context(), session)
-			if err != nil {
-				c.JSON(http.StatusInsufficientStorage, gin.H{"message": "Failed to save session"})
-				return
-			}
+	a.respondTokens(c, session.Username, session.ID, refreshToken)
+}
 
-			c.JSON(http.StatusOK, gin.H{"token": token})
-			return
-		}
+func (a *api) respondTokens(c *gin.Context, username string, sessionID string, refreshToken string) {
+	user, err := a.s.GetUser(c.Request.Context(), username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to initiate session token"})
+		return
+	}
 
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-			"message": "Failed to verify user session",
-		})
+	token, err := a.newAPIToken(user, sessionID, a.config.AccessTokenTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to initiate session token"})
 		return
 	}
 
-	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
-		"message": "There is already an active session using your account",
+	c.JSON(http.StatusOK, &tokenResp{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(a.config.AccessTokenTTL / time.Second),
 	})
+}
+
+// revokeSession logout the session of the token making the request.
+func (a *api) revokeSession(c *gin.Context) {
+	username := c.GetString(usernameContext)
+
+	err := a.s.RevokeSession(c.Request.Context(), username, c.GetString(sessionContext))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process logout request"})
+		return
+	}
 
+	c.JSON(http.StatusOK, nil)
 }
 
+// revokeAllSessions logout every session of the user making the request.
 func (a *api) revokeAllSessions(c *gin.Context) {
 	username := c.GetString(usernameContext)
-	coll := a.db.Collection("sessions")
-
-	_, err := coll.UpdateMany(c.Request.Context(), bson.M{"username": username}, bson.M{"$set": bson.M{
-		"status": "inactive",
-	}})
 
+	err := a.s.RevokeSessions(c.Request.Context(), username)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to process logout request"})
 		return
@@ -105,18 +151,36 @@ func (a *api) revokeAllSessions(c *gin.Context) {
 	c.JSON(http.StatusOK, nil)
 }
 
-// newAPIToken generate API token with 30 days expiring duration for authorizing other request.
-func newAPIToken(username string, secret string) (string, error) {
+// listSessions returns active sessions of the user making the request.
+func (a *api) listSessions(c *gin.Context) {
+	sessions, err := a.s.Sessions(c.Request.Context(), c.GetString(usernameContext))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to list sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// jwks publish the public keys tokens are verified with.
+func (a *api) jwks(c *gin.Context) {
+	c.JSON(http.StatusOK, a.keys.jwks())
+}
+
+// newAPIToken generate API token expiring after ttl for authorizing other request, the token
+// carries the session ID as its jwt ID and the permissions granted by the user roles.
+func (a *api) newAPIToken(user *models.User, sessionID string, ttl time.Duration) (string, error) {
 	claims := &apiTokenClaims{
 		StandardClaims: jwt.StandardClaims{
+			Id:        sessionID,
 			Subject:   "authotization_token",
 			Audience:  "vendingmachine",
-			ExpiresAt: time.Now().Add(24 * 30 * time.Hour).Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
 		},
-		Username: username,
+		Username:    user.Username,
+		Roles:       user.Roles,
+		Permissions: a.roles.Permissions(a.grantedRoles(user)),
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	return token.SignedString([]byte(secret))
+	return a.keys.sign(claims)
 }
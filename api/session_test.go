@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+
+	logIn := func(userAgent string) string {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(&logInParams{Username: buyer, Password: "vending-pass1"})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent)
+
+		api.handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+		resp := tokenResp{}
+		err := json.NewDecoder(rr.Result().Body).Decode(&resp)
+		assert.NoError(t, err)
+
+		return resp.Token
+	}
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		req, err := http.NewRequest(method, path, nil)
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", token)
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	phone := logIn("phone")
+	laptop := logIn("laptop")
+
+	rr := request(http.MethodGet, "/sessions", phone)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	sessions := []models.Session{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&sessions)
+	assert.NoError(t, err)
+
+	// the session created by setupTestCases plus both logins.
+	assert.Len(t, sessions, 3)
+	assert.Equal(t, "phone", sessions[1].UserAgent)
+	assert.Equal(t, "laptop", sessions[2].UserAgent)
+
+	// logging out the phone keeps the laptop session valid.
+	rr = request(http.MethodPost, "/logout", phone)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/user", phone)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodGet, "/user", laptop)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	// logging out everywhere revokes the remaining sessions.
+	rr = request(http.MethodPost, "/logout/all", laptop)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	for _, token := range []string{laptop, userToken[buyer]} {
+		rr = request(http.MethodGet, "/user", token)
+		assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+	}
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestRefreshToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+
+	post := func(path string, params interface{}) (*httptest.ResponseRecorder, tokenResp) {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		api.handler.ServeHTTP(rr, req)
+
+		resp := tokenResp{}
+		_ = json.NewDecoder(rr.Result().Body).Decode(&resp)
+
+		return rr, resp
+	}
+
+	getUser := func(token string) int {
+		rr := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodGet, "/user", nil)
+		req.Header.Set("Authorization", token)
+
+		api.handler.ServeHTTP(rr, req)
+		return rr.Result().StatusCode
+	}
+
+	rr, login := post("/login", &logInParams{Username: buyer, Password: "vending-pass1"})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+	assert.Equal(t, int64(api.config.AccessTokenTTL/time.Second), login.ExpiresIn)
+
+	rr, refreshed := post("/token/refresh", &refreshTokenParams{RefreshToken: login.RefreshToken})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+	assert.NotEqual(t, login.RefreshToken, refreshed.RefreshToken)
+	assert.Equal(t, http.StatusOK, getUser(refreshed.Token))
+
+	rr, _ = post("/token/refresh", &refreshTokenParams{RefreshToken: "unknown.token"})
+	assert.Equal(t, http.StatusUnauthorized, rr.Result().StatusCode)
+
+	// presenting the rotated refresh token again revokes the whole session.
+	rr, _ = post("/token/refresh", &refreshTokenParams{RefreshToken: login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rr.Result().StatusCode)
+
+	assert.Equal(t, http.StatusForbidden, getUser(refreshed.Token))
+
+	rr, _ = post("/token/refresh", &refreshTokenParams{RefreshToken: refreshed.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, rr.Result().StatusCode)
+
+	// other sessions of the user are not affected.
+	assert.Equal(t, http.StatusOK, getUser(userToken[buyer]))
+
+	session, _, err := api.s.NewSession(context.Background(), buyer, "", "")
+	assert.NoError(t, err)
+
+	expired, err := api.newAPIToken(&testUsers[0], session.ID, -time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, getUser(expired))
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestLoginLockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	config.LoginMaxFailures = 3
+	config.LoginBackoff = 20 * time.Millisecond
+	config.LoginMaxBackoff = 40 * time.Millisecond
+	config.LoginLockout = time.Hour
+
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+	seller := testUsers[1].Username
+
+	logIn := func(username, password, ip string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(&logInParams{Username: username, Password: password})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":1234"
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := logIn(buyer, "wrong", "10.0.0.1")
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	// the next attempt is delayed even with the right password.
+	rr = logIn(buyer, "vending-pass1", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Result().StatusCode)
+	assert.Equal(t, "1", rr.Result().Header.Get("Retry-After"))
+
+	for _, wait := range []time.Duration{20 * time.Millisecond, 40 * time.Millisecond} {
+		time.Sleep(wait)
+
+		rr = logIn(buyer, "wrong", "10.0.0.1")
+		assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+	}
+
+	rr = logIn(buyer, "vending-pass1", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Result().StatusCode)
+	assert.Equal(t, "3600", rr.Result().Header.Get("Retry-After"))
+
+	// both the username and the client ip are locked out.
+	rr = logIn(buyer, "vending-pass1", "10.0.0.2")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Result().StatusCode)
+
+	rr = logIn(seller, "vending-pass1", "10.0.0.1")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Result().StatusCode)
+
+	rr = logIn(seller, "vending-pass1", "10.0.0.2")
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	err = api.s.UnlockUser(context.Background(), "@test", buyer)
+	assert.NoError(t, err)
+
+	rr = logIn(buyer, "vending-pass1", "10.0.0.2")
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/gin-gonic/gin"
+)
+
+type totpCodeParams struct {
+	Code string `json:"code"`
+}
+
+// enrolTOTP returns a new TOTP secret and its otpauth URI to scan with an authenticator
+// app, two-factor authentication is enabled once a code is confirmed.
+func (a *api) enrolTOTP(c *gin.Context) {
+	enrolment, err := a.s.EnrolTOTP(c.Request.Context(), c.GetString(usernameContext))
+	if err != nil {
+		switch err {
+		case vendingmachine.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		case vendingmachine.ErrTOTPEnabled:
+			c.JSON(http.StatusConflict, gin.H{"message": "Two-factor authentication is already enabled"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to enrol two-factor authentication"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, enrolment)
+}
+
+// confirmTOTP enable two-factor authentication and returns the recovery codes, they are
+// only shown once.
+func (a *api) confirmTOTP(c *gin.Context) {
+	params := totpCodeParams{}
+
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	codes, err := a.s.ConfirmTOTP(c.Request.Context(), c.GetString(usernameContext), params.Code)
+	if err != nil {
+		switch err {
+		case vendingmachine.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		case vendingmachine.ErrTOTPEnabled:
+			c.JSON(http.StatusConflict, gin.H{"message": "Two-factor authentication is already enabled"})
+		case vendingmachine.ErrTOTPNotEnrolled:
+			c.JSON(http.StatusConflict, gin.H{"message": "Two-factor authentication enrolment not started"})
+		case vendingmachine.ErrInvalidOTP:
+			c.JSON(http.StatusForbidden, gin.H{"message": "One-time password is incorrect"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to confirm two-factor authentication"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+// disableTOTP turn off two-factor authentication given a TOTP or recovery code.
+func (a *api) disableTOTP(c *gin.Context) {
+	params := totpCodeParams{}
+
+	if !bindJSON(c, &params) {
+		return
+	}
+
+	err := a.s.DisableTOTP(c.Request.Context(), c.GetString(usernameContext), params.Code)
+	if err != nil {
+		switch err {
+		case vendingmachine.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		case vendingmachine.ErrTOTPNotEnrolled:
+			c.JSON(http.StatusConflict, gin.H{"message": "Two-factor authentication is not enabled"})
+		case vendingmachine.ErrInvalidOTP:
+			c.JSON(http.StatusForbidden, gin.H{"message": "One-time password is incorrect"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to disable two-factor authentication"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, nil)
+}
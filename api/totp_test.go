@@ -0,0 +1,126 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSellerTOTP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	config.SellerTOTPRequired = true
+
+	// rejected codes are not throttled so the test does not wait for backoffs.
+	config.LoginMaxFailures = 0
+
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	seller := testUsers[1].Username
+
+	request := func(method, path, token string, params interface{}) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		body, _ := json.Marshal(params)
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// sellers cannot use seller endpoints before enabling two-factor authentication.
+	rr := request(http.MethodGet, "/seller/earnings", userToken[seller], nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/user/totp", userToken[seller], nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	enrolment := models.TOTPEnrolment{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&enrolment)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(enrolment.URI, "otpauth://totp/VendingMachine:seller1?"))
+	assert.Contains(t, enrolment.URI, "secret="+enrolment.Secret)
+
+	step := models.TOTPStep(time.Now())
+	code, err := models.TOTPCode(enrolment.Secret, step)
+	assert.NoError(t, err)
+
+	rr = request(http.MethodPost, "/user/totp/confirm", userToken[seller], &totpCodeParams{Code: "000000"})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/user/totp/confirm", userToken[seller], &totpCodeParams{Code: code})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	confirmed := struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&confirmed)
+	assert.NoError(t, err)
+	assert.Len(t, confirmed.RecoveryCodes, 10)
+
+	// permissions are granted when tokens are issued, the current token still lacks them.
+	rr = request(http.MethodGet, "/seller/earnings", userToken[seller], nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	// logins now need a second factor.
+	rr = request(http.MethodPost, "/login", "", &logInParams{Username: seller, Password: "vending-pass1"})
+	assert.Equal(t, http.StatusUnauthorized, rr.Result().StatusCode)
+
+	// the code used to confirm the enrolment cannot be replayed.
+	rr = request(http.MethodPost, "/login", "", &logInParams{Username: seller, Password: "vending-pass1", OTP: code})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	next, err := models.TOTPCode(enrolment.Secret, step+1)
+	assert.NoError(t, err)
+
+	rr = request(http.MethodPost, "/login", "", &logInParams{Username: seller, Password: "vending-pass1", OTP: next})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	tokens := tokenResp{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&tokens)
+	assert.NoError(t, err)
+
+	rr = request(http.MethodGet, "/seller/earnings", tokens.Token, nil)
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/login", "", &logInParams{Username: seller, Password: "vending-pass1", OTP: confirmed.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/login", "", &logInParams{Username: seller, Password: "vending-pass1", OTP: confirmed.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	rr = request(http.MethodDelete, "/user/totp", userToken[seller], &totpCodeParams{Code: confirmed.RecoveryCodes[1]})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	rr = request(http.MethodPost, "/token/refresh", "", &refreshTokenParams{RefreshToken: tokens.RefreshToken})
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	tokens = tokenResp{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&tokens)
+	assert.NoError(t, err)
+
+	rr = request(http.MethodGet, "/seller/earnings", tokens.Token, nil)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
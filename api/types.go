@@ -5,33 +5,105 @@ import "github.com/bcmmbaga/vending-machine/models"
 type signUpParams struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"required"`
+
+	// Role is kept for clients signing up with a single role, Roles can hold several.
+	Role  string   `json:"role" binding:"required_without=Roles"`
+	Roles []string `json:"roles" binding:"required_without=Role"`
 }
 
 type depositParams struct {
-	Coins models.Coins `json:"coins"`
+	MachineID string       `json:"machineId" binding:"required"`
+	Coins     models.Coins `json:"coins"`
+}
+
+type resetDepositParams struct {
+	MachineID string `json:"machineId" binding:"required"`
 }
 
 type newProductParams struct {
 	Name      string `json:"name" binding:"required"`
-	Available int    `json:"available" binding:"required"`
-	Cost      int    `json:"cost" binding:"required"`
+	Available int    `json:"available" binding:"min=0"`
+	Cost      int    `json:"cost" binding:"required,gt=0"`
 }
 
 type updateProductParams struct {
 	Name      string `json:"name,omitempty"`
-	Available int    `json:"available,omitempty"`
-	Cost      int    `json:"cost,omitempty"`
+	Available int    `json:"available,omitempty" binding:"omitempty,min=0"`
+	Cost      int    `json:"cost,omitempty" binding:"omitempty,min=0"`
+}
+
+type listProductsParams struct {
+	Seller  string `form:"seller"`
+	MinCost int    `form:"minCost"`
+	MaxCost int    `form:"maxCost"`
+	InStock bool   `form:"inStock"`
+	Search  string `form:"q"`
+
+	// Sort is one of name, cost or available, prefixed with - for descending order.
+	Sort   string `form:"sort"`
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"`
 }
 
 type buyProductParams struct {
-	ProductID string `json:"productId" binding:"required"`
-	Quantity  int    `json:"quantity" binding:"required"`
+	MachineID string `json:"machineId" binding:"required"`
+	Slot      string `json:"slot" binding:"required"`
+	Quantity  int    `json:"quantity" binding:"required,min=1"`
 }
 
 type buyProductResp struct {
+	OrderID         string `json:"orderId"`
 	TotalSpent      int    `json:"totalSpent"`
 	ProductName     string `json:"productName"`
 	ProductQuantity int    `json:"productQuantity"`
+	MachineID       string `json:"machineId"`
+	Slot            string `json:"slot"`
+	Currency        string `json:"currency"`
 	Change          []int  `json:"change,omitempty"`
+	Deposit         int    `json:"deposit"`
+}
+
+type checkoutParams struct {
+	MachineID string               `json:"machineId" binding:"required"`
+	Items     []checkoutItemParams `json:"items" binding:"required,min=1,dive"`
+}
+
+type checkoutItemParams struct {
+	Slot     string `json:"slot" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+}
+
+type checkoutResp struct {
+	CheckoutID string             `json:"checkoutId"`
+	Items      []checkoutItemResp `json:"items"`
+	TotalSpent int                `json:"totalSpent"`
+	Currency   string             `json:"currency"`
+	Change     []int              `json:"change,omitempty"`
+	Deposit    int                `json:"deposit"`
+}
+
+type checkoutItemResp struct {
+	OrderID         string `json:"orderId"`
+	ProductID       string `json:"productId"`
+	ProductName     string `json:"productName"`
+	ProductQuantity int    `json:"productQuantity"`
+	Slot            string `json:"slot"`
+	UnitCost        int    `json:"unitCost"`
+	Total           int    `json:"total"`
+}
+
+type resetDepositResp struct {
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+	Change   []int  `json:"change,omitempty"`
+}
+
+type listOrdersParams struct {
+	Limit  int    `form:"limit"`
+	Cursor string `form:"cursor"`
+}
+
+type payoutParams struct {
+	Currency string `json:"currency" binding:"required"`
+	Amount   int    `json:"amount" binding:"min=0"`
 }
@@ -1,42 +1,38 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 
+	vendingmachine "github.com/bcmmbaga/vending-machine"
 	"github.com/bcmmbaga/vending-machine/models"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 func (a *api) SignUpNewUser(c *gin.Context) {
 	params := signUpParams{}
 
-	err := c.BindJSON(&params)
-	if err != nil {
-		if syntaxError, ok := err.(*json.SyntaxError); ok {
-			c.JSON(http.StatusBadRequest, syntaxError)
-			return
-		}
-	}
-
-	coll := a.db.Collection("users")
-	res := coll.FindOne(c.Request.Context(), bson.M{"username": params.Username})
-	if res.Err() != mongo.ErrNoDocuments {
-		c.JSON(http.StatusForbidden, gin.H{"message": "Username already existed"})
+	if !bindJSON(c, &params) {
 		return
 	}
 
-	user, err := models.NewUser(params.Username, params.Password, params.Role)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
-		return
+	roles := params.Roles
+	if params.Role != "" {
+		roles = append([]string{params.Role}, roles...)
 	}
 
-	_, err = coll.InsertOne(c.Request.Context(), user)
+	user, err := a.s.NewUser(c.Request.Context(), params.Username, params.Password, roles)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save new user"})
+		if validationErr, ok := err.(*vendingmachine.ValidationError); ok {
+			respondValidationError(c, validationErr)
+			return
+		}
+
+		if err == vendingmachine.ErrUserExists {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Username already existed"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
 
@@ -51,12 +47,9 @@ func (a *api) GetUser(c *gin.Context) {
 		return
 	}
 
-	user := models.User{}
-
-	coll := a.db.Collection("users")
-	err := coll.FindOne(c.Request.Context(), bson.M{"username": username}).Decode(&user)
+	user, err := a.s.GetUser(c.Request.Context(), username)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == vendingmachine.ErrUserNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
 			return
 		}
@@ -69,17 +62,40 @@ func (a *api) GetUser(c *gin.Context) {
 }
 
 func (a *api) ResetDeposit(c *gin.Context) {
-	coll := a.db.Collection("users")
+	params := resetDepositParams{}
+
+	if !bindJSON(c, &params) {
+		return
+	}
 
 	username := c.GetString(usernameContext)
 
-	_, err := coll.UpdateOne(c.Request.Context(), bson.M{"username": username}, bson.M{"$set": bson.M{"deposit": 0}})
+	refund, err := a.s.ResetDeposit(c.Request.Context(), username, params.MachineID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to reset deposit"})
+		switch err {
+		case vendingmachine.ErrUserNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+		case vendingmachine.ErrMachineNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "machine not found"})
+		case vendingmachine.ErrMachineUnavailable:
+			c.JSON(http.StatusConflict, gin.H{"message": "Machine is not active"})
+		case vendingmachine.ErrDepositElsewhere:
+			c.JSON(http.StatusConflict, gin.H{"message": "Deposit is held by another machine, reset it there"})
+		case vendingmachine.ErrDepositCurrency:
+			c.JSON(http.StatusConflict, gin.H{"message": "Deposit is in another currency than the machine"})
+		case models.ErrExactChangeUnavailable:
+			c.JSON(http.StatusConflict, gin.H{"message": "Exact change cannot be made to refund the deposit"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to reset deposit"})
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, nil)
+	c.JSON(http.StatusOK, &resetDepositResp{
+		Amount:   refund.Amount,
+		Currency: refund.Currency,
+		Change:   a.changeCounts(refund.Currency, refund.Coins),
+	})
 }
 
 func (a *api) DeleteUser(c *gin.Context) {
@@ -90,12 +106,14 @@ func (a *api) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	user := models.User{}
-
-	coll := a.db.Collection("users")
-	err := coll.FindOneAndDelete(c.Request.Context(), bson.M{"username": username}).Decode(&user)
+	user, err := a.s.DeleteUser(c.Request.Context(), username)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete user acccount"})
+		switch err {
+		case vendingmachine.ErrBalanceNotEmpty:
+			c.JSON(http.StatusConflict, gin.H{"message": "Withdraw the deposit and earnings before deleting the account"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to delete user acccount"})
+		}
 		return
 	}
 
@@ -105,38 +123,30 @@ func (a *api) DeleteUser(c *gin.Context) {
 func (a *api) deposit(c *gin.Context) {
 	params := depositParams{}
 
-	err := c.BindJSON(&params)
-	if err != nil {
-		if syntaxError, ok := err.(*json.SyntaxError); ok {
-			c.JSON(http.StatusBadRequest, syntaxError)
-			return
-		}
+	if !bindJSON(c, &params) {
+		return
 	}
 
-	user := models.User{}
 	username := c.GetString(usernameContext)
 
-	coll := a.db.Collection("users")
-	err = coll.FindOne(c.Request.Context(), bson.M{"username": username}).Decode(&user)
+	user, err := a.s.Deposit(c.Request.Context(), username, params.MachineID, params.Coins)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		switch err {
+		case vendingmachine.ErrUserNotFound:
 			c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
-			return
+		case vendingmachine.ErrMachineNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"message": "machine not found"})
+		case vendingmachine.ErrMachineUnavailable:
+			c.JSON(http.StatusConflict, gin.H{"message": "Machine is not active"})
+		case vendingmachine.ErrDepositElsewhere:
+			c.JSON(http.StatusConflict, gin.H{"message": "Deposit is held by another machine, spend or reset it there first"})
+		case vendingmachine.ErrDepositCurrency:
+			c.JSON(http.StatusConflict, gin.H{"message": "Deposit is in another currency than the machine"})
+		case models.ErrCoinNotAccepted:
+			c.JSON(http.StatusBadRequest, err.Error())
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to deposit"})
 		}
-
-		c.JSON(http.StatusInternalServerError, err.Error())
-		return
-	}
-
-	err = user.AddDeposit(params.Coins)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, err.Error())
-		return
-	}
-
-	_, err = coll.UpdateOne(c.Request.Context(), bson.M{"username": username}, bson.M{"$set": bson.M{"deposit": user.Deposit}})
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to deposit"})
 		return
 	}
 
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	vendingmachine "github.com/bcmmbaga/vending-machine"
@@ -16,11 +17,11 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
-	"go.mongodb.org/mongo-driver/bson"
 )
 
 var userToken = map[string]string{}
 var productId string
+var machineId string
 
 func TestDeposit(t *testing.T) {
 	gin.SetMode(gin.TestMode)
@@ -58,7 +59,8 @@ func TestDeposit(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		buf, err := json.Marshal(&depositParams{
-			Coins: test.coins,
+			MachineID: machineId,
+			Coins:     test.coins,
 		})
 		assert.NoError(t, err)
 
@@ -87,6 +89,99 @@ func TestDeposit(t *testing.T) {
 
 }
 
+func TestResetDeposit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+
+	_, err = api.s.Deposit(context.Background(), testUsers[0].Username, machineId, models.Coins{10, 50, 100, 100})
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	buf, err := json.Marshal(&resetDepositParams{MachineID: machineId})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/reset", bytes.NewBuffer(buf))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", userToken[testUsers[0].Username])
+	assert.NoError(t, err)
+
+	api.handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	resp := resetDepositResp{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&resp)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 260, resp.Amount)
+	assert.Equal(t, []int{0, 1, 0, 1, 2}, resp.Change)
+
+	buyer, err := api.s.GetUser(context.Background(), testUsers[0].Username)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, buyer.Deposit)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestDeleteUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+	buyer := testUsers[0].Username
+	ctx := context.Background()
+
+	key, _, err := api.s.CreateAPIKey(ctx, buyer, "reports", []string{models.PermOrderRead}, nil)
+	assert.NoError(t, err)
+
+	deleteUser := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodDelete, "/user", nil)
+		req.Header.Set("Authorization", userToken[buyer])
+
+		api.handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// the account is kept while the deposit is not withdrawn.
+	_, err = api.s.Deposit(ctx, buyer, machineId, models.Coins{10})
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusConflict, deleteUser().Result().StatusCode)
+
+	_, err = api.s.GetUser(ctx, buyer)
+	assert.NoError(t, err)
+
+	_, err = api.s.ResetDeposit(ctx, buyer, machineId)
+	assert.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, deleteUser().Result().StatusCode)
+
+	_, err = api.s.GetUser(ctx, buyer)
+	assert.Equal(t, vendingmachine.ErrUserNotFound, err)
+
+	// sessions and api keys of the deleted user are revoked.
+	assert.Equal(t, http.StatusForbidden, deleteUser().Result().StatusCode)
+
+	keys, err := api.store.ListAPIKeys(ctx, buyer)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+	assert.True(t, keys[0].Revoked)
+
+	err = api.removeTestCases(testUsers[1:])
+	assert.NoError(t, err)
+}
+
 func TestBuy(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -95,27 +190,42 @@ func TestBuy(t *testing.T) {
 
 	testUsers := api.setupTestCases()
 
+	_, err = api.s.Deposit(context.Background(), testUsers[0].Username, machineId, models.Coins{10, 50, 100})
+	assert.NoError(t, err)
+
 	testCases := []struct {
-		productID    string
+		slot         string
 		username     string
 		quantity     int
 		responseCode int
 		change       []int
 	}{
 		{
-			productID:    productId,
+			slot:         "A1",
 			username:     testUsers[1].Username,
 			quantity:     13,
 			responseCode: 403,
 		},
 		{
-			productID:    productId,
+			slot:         "A1",
 			username:     testUsers[0].Username,
 			quantity:     63,
 			responseCode: 400,
 		},
 		{
-			productID:    productId,
+			slot:         "B1",
+			username:     testUsers[0].Username,
+			quantity:     1,
+			responseCode: 404,
+		},
+		{
+			slot:         "A1",
+			username:     testUsers[0].Username,
+			quantity:     -1,
+			responseCode: 422,
+		},
+		{
+			slot:         "a1",
 			username:     testUsers[0].Username,
 			quantity:     15,
 			responseCode: 200,
@@ -127,7 +237,8 @@ func TestBuy(t *testing.T) {
 		rr := httptest.NewRecorder()
 
 		buf, err := json.Marshal(&buyProductParams{
-			ProductID: test.productID,
+			MachineID: machineId,
+			Slot:      test.slot,
 			Quantity:  test.quantity,
 		})
 		assert.NoError(t, err)
@@ -145,6 +256,8 @@ func TestBuy(t *testing.T) {
 			assert.NoError(t, err)
 
 			assert.Equal(t, test.change, resp.Change)
+			assert.Equal(t, 0, resp.Deposit)
+			assert.Equal(t, "A1", resp.Slot)
 
 		} else {
 			assert.Equal(t, test.responseCode, rr.Result().StatusCode)
@@ -156,6 +269,97 @@ func TestBuy(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestBuyWalletMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config, err := vendingmachine.LoadConfiguration("../.env")
+	assert.NoError(t, err)
+
+	config.VendMode = vendingmachine.VendModeWallet
+	api, err := NewServer(config, storage.NewMemory())
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+
+	_, err = api.s.Deposit(context.Background(), testUsers[0].Username, machineId, models.Coins{100})
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	buf, err := json.Marshal(&buyProductParams{
+		MachineID: machineId,
+		Slot:      "A1",
+		Quantity:  3,
+	})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/buy", bytes.NewBuffer(buf))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", userToken[testUsers[0].Username])
+	assert.NoError(t, err)
+
+	api.handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Result().StatusCode)
+
+	resp := buyProductResp{}
+	err = json.NewDecoder(rr.Result().Body).Decode(&resp)
+	assert.NoError(t, err)
+
+	// no change is dispensed, the balance left is kept as deposit.
+	assert.Nil(t, resp.Change)
+	assert.Equal(t, 70, resp.Deposit)
+
+	buyer, err := api.s.GetUser(context.Background(), testUsers[0].Username)
+	assert.NoError(t, err)
+	assert.Equal(t, 70, buyer.Deposit)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
+func TestBuyWithoutExactChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	testUsers := api.setupTestCases()
+
+	_, err = api.s.Deposit(context.Background(), testUsers[0].Username, machineId, models.Coins{100})
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+
+	buf, err := json.Marshal(&buyProductParams{
+		MachineID: machineId,
+		Slot:      "A1",
+		Quantity:  1,
+	})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/buy", bytes.NewBuffer(buf))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", userToken[testUsers[0].Username])
+	assert.NoError(t, err)
+
+	api.handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Result().StatusCode)
+
+	// the sale is rejected before any money or stock moves.
+	buyer, err := api.s.GetUser(context.Background(), testUsers[0].Username)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, buyer.Deposit)
+
+	slot, err := api.s.GetSlot(context.Background(), machineId, "A1")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, slot.Count)
+
+	err = api.removeTestCases(testUsers)
+	assert.NoError(t, err)
+}
+
 func TestGetProduct(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -216,54 +420,51 @@ func setupNewAPIServer() (*api, error) {
 		return nil, err
 	}
 
-	conn, err := storage.Dial(config)
-	if err != nil {
-		return nil, err
-	}
-
-	return NewServer(config, conn), nil
+	return NewServer(config, storage.NewMemory())
 
 }
 
 func (a *api) setupTestCases() []models.User {
-	coll := a.db.Collection("users")
-
-	buyer, _ := models.NewUser("buyer1", "123456", "buyer")
-	buyer.AddDeposit(models.Coins{10, 50, 100})
+	ctx := context.Background()
 
-	seller, _ := models.NewUser("seller1", "123456", "seller")
+	buyer, err := a.s.NewUser(ctx, "buyer1", "vending-pass1", []string{"buyer"})
+	if err != nil {
+		log.Fatalf("Failed to setup user test cases: %s", err.Error())
+	}
 
-	_, err := coll.InsertMany(context.Background(), []interface{}{
-		buyer,
-		seller,
-	})
+	seller, err := a.s.NewUser(ctx, "seller1", "vending-pass1", []string{"seller"})
 	if err != nil {
 		log.Fatalf("Failed to setup user test cases: %s", err.Error())
 	}
 
-	buyerToken, _ := newAPIToken(buyer.Username, a.config.Secret)
-	userToken[buyer.Username] = buyerToken
+	for _, user := range []*models.User{buyer, seller} {
+		session, _, err := a.s.NewSession(ctx, user.Username, "", "")
+		if err != nil {
+			log.Fatalf("Failed to setup session test cases: %s", err.Error())
+		}
 
-	sellerToken, _ := newAPIToken(seller.Username, a.config.Secret)
-	userToken[seller.Username] = sellerToken
+		token, _ := a.newAPIToken(user, session.ID, a.config.AccessTokenTTL)
+		userToken[user.Username] = token
+	}
 
-	coll = a.db.Collection("sessions")
-	_, err = coll.InsertMany(context.Background(), []interface{}{
-		models.NewSession(buyer.Username, buyerToken),
-		models.NewSession(seller.Username, sellerToken),
-	})
+	product, err := a.s.NewProduct(ctx, seller.Username, "testing", 60, 10)
 	if err != nil {
-		log.Fatalf("Failed to setup session test cases: %s", err.Error())
+		log.Fatalf("Failed to setup product test cases: %s", err.Error())
 	}
 
-	coll = a.db.Collection("products")
-
-	product := models.NewProduct("testing", 30, 10, seller.Username)
 	productId = product.ID
 
-	_, err = coll.InsertOne(context.Background(), product)
+	machine, err := a.s.NewMachine(ctx, "lobby", "ground floor", "")
 	if err != nil {
-		log.Fatalf("Failed to setup product test cases: %s", err.Error())
+		log.Fatalf("Failed to setup machine test cases: %s", err.Error())
+	}
+
+	machineId = machine.ID
+
+	// half of the product stock is loaded in the machine.
+	_, err = a.s.NewSlot(ctx, machine.ID, "A1", product.ID, 50, 30)
+	if err != nil {
+		log.Fatalf("Failed to setup slot test cases: %s", err.Error())
 	}
 
 	return []models.User{*buyer, *seller}
@@ -271,19 +472,16 @@ func (a *api) setupTestCases() []models.User {
 }
 
 func (a *api) removeTestCases(users []models.User) error {
-	coll := a.db.Collection("users")
+	ctx := context.Background()
 
+	// test users are removed from the store directly, their balances are left unsettled.
 	for _, user := range users {
-		_, err := coll.DeleteOne(context.Background(), bson.M{"username": user.Username})
+		_, err := a.store.DeleteUser(ctx, user.Username)
 		if err != nil {
 			return err
 		}
-	}
-
-	coll = a.db.Collection("sessions")
 
-	for _, user := range users {
-		_, err := coll.DeleteOne(context.Background(), bson.M{"username": user.Username})
+		err = a.s.RevokeSessions(ctx, user.Username)
 		if err != nil {
 			return err
 		}
@@ -291,3 +489,64 @@ func (a *api) removeTestCases(users []models.User) error {
 
 	return nil
 }
+
+func TestSignUpValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	api, err := setupNewAPIServer()
+	assert.NoError(t, err)
+
+	signUp := func(body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		rr := httptest.NewRecorder()
+
+		req := httptest.NewRequest(http.MethodPost, "/user", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+
+		api.handler.ServeHTTP(rr, req)
+
+		resp := map[string]interface{}{}
+		_ = json.NewDecoder(rr.Result().Body).Decode(&resp)
+
+		return rr, resp
+	}
+
+	fields := func(resp map[string]interface{}) []string {
+		names := []string{}
+		errs, _ := resp["errors"].([]interface{})
+		for _, e := range errs {
+			names = append(names, e.(map[string]interface{})["field"].(string))
+		}
+		return names
+	}
+
+	rr, resp := signUp(`{"username": "bad name!", "password": "123456", "role": "admin"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+	assert.Equal(t, []string{"username", "password", "password", "password", "roles"}, fields(resp))
+
+	rr, resp = signUp(`{"username": "newbuyer"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+	assert.Equal(t, []string{"password", "role", "roles"}, fields(resp))
+
+	rr, resp = signUp(`{"username": "newbuyer", "password": "vending-pass1", "roles": ["buyer", "admin"]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+	assert.Equal(t, []string{"roles"}, fields(resp))
+
+	rr, resp = signUp(`{"username": "newbuyer", "password": 12345678, "role": "buyer"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Result().StatusCode)
+	assert.Equal(t, []string{"password"}, fields(resp))
+
+	rr, resp = signUp(`{"username": "NewBuyer", "password": "vending-pass1", "role": "buyer"}`)
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	assert.Equal(t, "newbuyer", resp["username"])
+
+	rr, resp = signUp(`{"username": "newtrader", "password": "vending-pass1", "roles": ["buyer", "seller"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Result().StatusCode)
+	assert.Equal(t, []interface{}{"buyer", "seller"}, resp["roles"])
+
+	// usernames are unique ignoring case.
+	rr, _ = signUp(`{"username": "NEWBUYER", "password": "vending-pass1", "role": "buyer"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Result().StatusCode)
+
+	_, err = api.s.Authenticate(context.Background(), "NewBuyer", "vending-pass1", "", "")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/service"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+// createAdmin create an admin with the username given as argument, the password is read
+// from the first line of stdin so it does not end up in the shell history.
+func createAdmin() {
+	if len(os.Args) < 3 {
+		log.Fatalln("usage: create-admin <username> < password-file")
+	}
+
+	username := os.Args[2]
+
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && password == "" {
+		log.Fatalln("password must be given on stdin")
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	store := openStore()
+	defer store.Close(ctx)
+
+	user, err := service.New(store, notify.Discard, &serverConfig).CreateAdmin(ctx, cliActor, username, password)
+	if err != nil {
+		store.Close(ctx)
+		log.Fatalln(err.Error())
+	}
+
+	fmt.Printf("admin %s created\n", user.Username)
+}
+
+// bootstrapAdmin create the admin named in config unless it already exists.
+func bootstrapAdmin(store storage.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err := service.New(store, notify.Discard, &serverConfig).CreateAdmin(ctx, configActor, serverConfig.AdminUsername, serverConfig.AdminPassword)
+	if err != nil && err != vendingmachine.ErrUserExists {
+		log.Fatalln(err.Error())
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	vendingmachine "github.com/bcmmbaga/vending-machine"
 	"github.com/bcmmbaga/vending-machine/api"
@@ -10,6 +11,13 @@ import (
 
 var serverConfig vendingmachine.Config
 
+const (
+	// cliActor and configActor are recorded in the audit trail as the actor of admin
+	// actions taken from the command line or the configuration.
+	cliActor    = "@cli"
+	configActor = "@config"
+)
+
 func init() {
 	config, err := vendingmachine.LoadConfiguration(".env")
 	if err != nil {
@@ -20,17 +28,59 @@ func init() {
 
 }
 
+// main serve the API unless a command is given as first argument.
 func main() {
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "serve":
+		serve()
+	case "reconcile":
+		reconcile()
+	case "unlock":
+		unlock()
+	case "create-admin":
+		createAdmin()
+	default:
+		log.Fatalf("unknown command %q, expected one of serve, reconcile, unlock, create-admin", command)
+	}
+}
+
+func serve() {
+	store := openStore()
 
-	conn, err := storage.Dial(&serverConfig)
+	if serverConfig.AdminUsername != "" {
+		bootstrapAdmin(store)
+	}
+
+	apiServer, err := api.NewServer(&serverConfig, store)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
 
-	apiServer := api.NewServer(&serverConfig, conn)
-
 	if err := apiServer.Start(); err != nil {
 		log.Fatalln(err.Error())
 	}
+}
+
+// openStore returns the storage backend selected in config.
+func openStore() storage.Store {
+	switch serverConfig.Storage {
+	case "memory":
+		return storage.NewMemory()
+	case "mongo":
+		conn, err := storage.Dial(&serverConfig)
+		if err != nil {
+			log.Fatalln(err.Error())
+		}
+
+		return conn
+	default:
+		log.Fatalf("unknown storage backend %q", serverConfig.Storage)
+	}
 
+	return nil
 }
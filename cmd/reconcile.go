@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/service"
+)
+
+// reconcile flags every user whose stored deposit or earnings disagree with the ledger, it exits with
+// status 1 when any discrepancy is found.
+func reconcile() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	store := openStore()
+	defer store.Close(ctx)
+
+	result, err := service.New(store, notify.Discard, &serverConfig).Reconcile(ctx)
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	for _, d := range result.Discrepancies {
+		fmt.Printf("%s\t%s\t%s\tbalance=%d\tledger=%d\tdiff=%d\n", d.Username, d.Account, d.Currency, d.Balance, d.Ledger, d.Balance-d.Ledger)
+	}
+
+	for currency, imbalance := range result.Imbalances {
+		fmt.Printf("%s ledger entries sum to %d instead of 0\n", currency, imbalance)
+	}
+
+	if !result.OK() {
+		store.Close(ctx)
+		os.Exit(1)
+	}
+
+	fmt.Println("balances agree with the ledger")
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/service"
+)
+
+// unlock forget failed logins of the username given as argument so the account can login
+// again before its lockout expires.
+func unlock() {
+	if len(os.Args) < 3 {
+		log.Fatalln("usage: unlock <username>")
+	}
+
+	username := os.Args[2]
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	store := openStore()
+	defer store.Close(ctx)
+
+	err := service.New(store, notify.Discard, &serverConfig).UnlockUser(ctx, cliActor, username)
+	if err != nil {
+		store.Close(ctx)
+		log.Fatalln(err.Error())
+	}
+
+	fmt.Printf("%s unlocked\n", username)
+}
@@ -1,8 +1,14 @@
 package vendingmachine
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/bcmmbaga/vending-machine/models"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -13,8 +19,103 @@ type Config struct {
 	Secret       string `required:"true" split_words:"true"`
 	DatabaseName string `required:"true" split_words:"true"`
 	DatabaseURI  string `required:"true" split_words:"true"`
+
+	// Storage select the storage backend, either mongo or memory. The memory backend
+	// keeps state in process and is meant for local development only.
+	Storage string `default:"mongo"`
+
+	// VendMode select what happens to the buyer balance left after a purchase, see
+	// VendModeSession and VendModeWallet.
+	VendMode string `default:"session" split_words:"true"`
+
+	// CassetteCapacity is how many coins of each denomination the cassette of a machine
+	// holds, deposited coins it has no room for drop into the cashbox.
+	CassetteCapacity int `default:"50" split_words:"true"`
+
+	// CurrenciesFile is a JSON object mapping currency codes to their coins and banknotes,
+	// the euro coins of models.DefaultCurrencies are used when it is empty. Currency is the
+	// code of the currency of machines created without one.
+	CurrenciesFile string `split_words:"true"`
+	Currency       string `default:"EUR"`
+
+	// AccessTokenTTL is how long an access token is accepted, RefreshTokenTTL is how long a
+	// session can go without refreshing its access token.
+	AccessTokenTTL  time.Duration `default:"15m" split_words:"true"`
+	RefreshTokenTTL time.Duration `default:"720h" split_words:"true"`
+
+	// KeyDir is a directory of PEM encoded RSA or Ed25519 keys tokens are signed with, the
+	// file name is the key ID. SigningKeyID select the key signing new tokens, it defaults
+	// to the last private key in file name order. Tokens are signed with Secret using HS256
+	// when KeyDir is empty.
+	KeyDir       string `split_words:"true"`
+	SigningKeyID string `split_words:"true"`
+
+	// Failed logins are tracked per username and per client IP. Every failure doubles the
+	// delay before the next attempt, starting at LoginBackoff up to LoginMaxBackoff, after
+	// LoginMaxFailures failures logins are locked out for LoginLockout. Zero
+	// LoginMaxFailures disables tracking.
+	LoginMaxFailures int           `default:"5" split_words:"true"`
+	LoginBackoff     time.Duration `default:"1s" split_words:"true"`
+	LoginMaxBackoff  time.Duration `default:"1m" split_words:"true"`
+	LoginLockout     time.Duration `default:"15m" split_words:"true"`
+
+	// TOTPIssuer names the service in authenticator apps. SellerTOTPRequired reject
+	// requests to seller endpoints until the seller enable two-factor authentication.
+	TOTPIssuer         string `default:"VendingMachine" split_words:"true"`
+	SellerTOTPRequired bool   `split_words:"true"`
+
+	// PasswordResetTTL is how long a password reset token can be used. Reset tokens are
+	// sent through the Notifier, "log" append them to NotifierLogFile.
+	PasswordResetTTL time.Duration `default:"1h" split_words:"true"`
+	Notifier         string        `default:"log"`
+	NotifierLogFile  string        `default:"notifications.log" split_words:"true"`
+
+	// Passwords must have PasswordMinLength characters including one of each of the
+	// PasswordRequiredClasses (lower, upper, digit or symbol). Common passwords are always
+	// rejected, PasswordDenylistFile list more of them one per line.
+	PasswordMinLength       int      `default:"8" split_words:"true"`
+	PasswordRequiredClasses []string `default:"lower,digit" split_words:"true"`
+	PasswordDenylistFile    string   `split_words:"true"`
+
+	// AdminUsername and AdminPassword bootstrap an admin account when the API starts, an
+	// existing account with that username is left untouched.
+	AdminUsername string `split_words:"true"`
+	AdminPassword string `split_words:"true"`
+
+	// IdempotencyTTL is how long responses of requests made with an Idempotency-Key are
+	// replayed to retries.
+	IdempotencyTTL time.Duration `default:"24h" split_words:"true"`
+
+	// IdempotencyLease is how long a pending request is left running before a retry with
+	// the same Idempotency-Key may take it over, it outlasts the slowest request.
+	IdempotencyLease time.Duration `default:"30s" split_words:"true"`
+
+	// RolesFile is a JSON object mapping role names to the permissions they grant, the
+	// buyer, seller, operator and admin roles of models.DefaultRoles are used when it is empty.
+	// SignUpRoles are the roles users can give themselves when signing up.
+	RolesFile   string   `split_words:"true"`
+	SignUpRoles []string `default:"buyer,seller" split_words:"true"`
+
+	// PasswordDenylist is read from PasswordDenylistFile by LoadConfiguration.
+	PasswordDenylist []string `ignored:"true"`
+
+	// Roles is read from RolesFile by LoadConfiguration.
+	Roles models.Roles `ignored:"true"`
+
+	// Currencies is read from CurrenciesFile by LoadConfiguration.
+	Currencies models.Currencies `ignored:"true"`
 }
 
+const (
+	// VendModeSession behave like a physical machine, the balance left after a purchase is
+	// dispensed as change and the deposit is zeroed.
+	VendModeSession = "session"
+
+	// VendModeWallet keep the balance left after a purchase as deposit for later purchases,
+	// no change is dispensed.
+	VendModeWallet = "wallet"
+)
+
 func loadEnvironment(filename string) error {
 	err := godotenv.Load(filename)
 
@@ -39,5 +140,72 @@ func LoadConfiguration(filename string) (*Config, error) {
 		return nil, err
 	}
 
+	if config.VendMode != VendModeSession && config.VendMode != VendModeWallet {
+		return nil, fmt.Errorf("unknown vend mode %q", config.VendMode)
+	}
+
+	for _, class := range config.PasswordRequiredClasses {
+		if class != "lower" && class != "upper" && class != "digit" && class != "symbol" {
+			return nil, fmt.Errorf("unknown password character class %q", class)
+		}
+	}
+
+	if config.PasswordDenylistFile != "" {
+		data, err := ioutil.ReadFile(config.PasswordDenylistFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if password := strings.TrimSpace(line); password != "" {
+				config.PasswordDenylist = append(config.PasswordDenylist, password)
+			}
+		}
+	}
+
+	config.Roles = models.DefaultRoles()
+	if config.RolesFile != "" {
+		data, err := ioutil.ReadFile(config.RolesFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Roles = models.Roles{}
+		if err := json.Unmarshal(data, &config.Roles); err != nil {
+			return nil, fmt.Errorf("invalid roles file %s: %w", config.RolesFile, err)
+		}
+	}
+
+	if err := config.Roles.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, role := range config.SignUpRoles {
+		if !config.Roles.Valid(role) {
+			return nil, fmt.Errorf("unknown sign up role %q", role)
+		}
+	}
+
+	config.Currencies = models.DefaultCurrencies()
+	if config.CurrenciesFile != "" {
+		data, err := ioutil.ReadFile(config.CurrenciesFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.Currencies = models.Currencies{}
+		if err := json.Unmarshal(data, &config.Currencies); err != nil {
+			return nil, fmt.Errorf("invalid currencies file %s: %w", config.CurrenciesFile, err)
+		}
+	}
+
+	if err := config.Currencies.Validate(); err != nil {
+		return nil, err
+	}
+
+	if config.Currencies[config.Currency] == nil {
+		return nil, fmt.Errorf("unknown currency %q", config.Currency)
+	}
+
 	return config, nil
 }
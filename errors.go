@@ -0,0 +1,103 @@
+package vendingmachine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserExists          = errors.New("username already exists")
+	ErrInvalidCredentials  = errors.New("username/password is incorrect")
+	ErrInvalidSession      = errors.New("invalid session token")
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token already used")
+	ErrOTPRequired         = errors.New("one-time password required")
+	ErrInvalidOTP          = errors.New("invalid one-time password")
+	ErrTOTPEnabled         = errors.New("two-factor authentication already enabled")
+	ErrTOTPNotEnrolled     = errors.New("two-factor authentication not enrolled")
+	ErrInvalidResetToken   = errors.New("invalid or expired password reset token")
+	ErrAccountSuspended    = errors.New("account suspended")
+	ErrSelfAdministration  = errors.New("admins cannot suspend or change the role of their own account")
+	ErrAuditNotFound       = errors.New("audit entry not found")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKey       = errors.New("invalid, expired or revoked api key")
+	ErrIdempotencyKeyReuse = errors.New("idempotency key already used with another request")
+	ErrRequestInProgress   = errors.New("request with the same idempotency key in progress")
+	ErrProductNotFound     = errors.New("product not found")
+	ErrMachineNotFound     = errors.New("machine not found")
+	ErrMachineUnavailable  = errors.New("machine is not active")
+	ErrMachineNotEmpty     = errors.New("machine still has slots")
+	ErrCashboxNotEmpty     = errors.New("machine cashbox still holds coins")
+	ErrMachineHoldsDeposit = errors.New("machine still holds user deposits")
+	ErrSlotNotFound        = errors.New("slot not found")
+	ErrSlotExists          = errors.New("slot code already used in the machine")
+	ErrSlotEmpty           = errors.New("slot has no product")
+	ErrCassetteFull        = errors.New("cassette has no room for the coins")
+	ErrUnknownCurrency     = errors.New("machine currency is not configured")
+	ErrSellerNotFound      = errors.New("seller not found")
+	ErrNotProductOwner     = errors.New("not product owner")
+	ErrProductInSlots      = errors.New("product is still loaded in machine slots")
+	ErrInvalidProductQuery = errors.New("invalid product query")
+	ErrInvalidCursor       = errors.New("invalid pagination cursor")
+	ErrInvalidQuantity     = errors.New("product quantity must be greater than zero")
+	ErrEmptyCart           = errors.New("cart has no items")
+	ErrInsufficientStock   = errors.New("product quantity left is not enough")
+	ErrInsufficientDeposit = errors.New("deposit balance is not enough")
+	ErrDepositElsewhere    = errors.New("deposit is held by another machine")
+	ErrDepositCurrency     = errors.New("deposit is in another currency than the machine")
+	ErrOrderNotFound       = errors.New("order not found")
+	ErrCheckoutNotFound    = errors.New("checkout not found")
+	ErrInvalidAmount       = errors.New("amount must be greater than zero")
+	ErrUnbalancedLedger    = errors.New("ledger transaction entries do not sum to zero")
+	ErrBalanceNotEmpty     = errors.New("deposit and earnings must be withdrawn before deleting the account")
+)
+
+// LoginLockedError is returned when login attempts are throttled after repeated failures,
+// no attempt is allowed before RetryAfter has passed.
+type LoginLockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginLockedError) Error() string {
+	return fmt.Sprintf("too many failed login attempts, retry after %s", e.RetryAfter)
+}
+
+// FieldError describe why the value of a request field was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when input values break validation rules, it lists every
+// rejected field rather than stopping at the first.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Add reject the field for each of the messages.
+func (e *ValidationError) Add(field string, messages ...string) {
+	for _, message := range messages {
+		e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+	}
+}
+
+// Err returns the validation error if any field was rejected, nil otherwise.
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Field + " " + f.Message
+	}
+
+	return "validation failed: " + strings.Join(messages, ", ")
+}
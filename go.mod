@@ -3,13 +3,13 @@ module github.com/bcmmbaga/vending-machine
 go 1.16
 
 require (
-	github.com/fatih/structs v1.1.0 // indirect
 	github.com/gin-gonic/gin v1.7.4
-	github.com/golang-jwt/jwt v3.2.2+incompatible // indirect
-	github.com/google/uuid v1.3.0 // indirect
+	github.com/go-playground/validator/v10 v10.4.1
+	github.com/golang-jwt/jwt v3.2.2+incompatible
+	github.com/google/uuid v1.3.0
 	github.com/joho/godotenv v1.4.0
-	github.com/kelseyhightower/envconfig v1.4.0 // indirect
-	github.com/stretchr/testify v1.7.0 // indirect
-	go.mongodb.org/mongo-driver v1.7.4 // indirect
-	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9 // indirect
+	github.com/kelseyhightower/envconfig v1.4.0
+	github.com/stretchr/testify v1.7.0
+	go.mongodb.org/mongo-driver v1.7.4
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
 )
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiKeyPrefix starts every API key so leaked keys are easy to recognise.
+const apiKeyPrefix = "vmk_"
+
+// APIKey let scripts and machine controllers call the API on behalf of a user without a
+// login session. Only the hash of the key is kept, Prefix is enough to tell keys apart.
+//
+// Scopes are the permissions the key is limited to, a key never grants more than the
+// current roles of its user.
+type APIKey struct {
+	ID         string     `json:"id" bson:"_id"`
+	Username   string     `json:"username"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	Revoked    bool       `json:"revoked"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// NewAPIKey returns the API key of the user with the key itself, the key never expires when
+// expiresAt is nil.
+func NewAPIKey(username string, name string, scopes []string, expiresAt *time.Time) (*APIKey, string) {
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(randomBytes(32))
+
+	return &APIKey{
+		ID:        uuid.Must(uuid.NewUUID()).String(),
+		Username:  username,
+		Name:      name,
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		Hash:      APIKeyHash(key),
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+		ExpiresAt: expiresAt,
+	}, key
+}
+
+// APIKeyHash returns the hash an API key is stored and looked up by.
+func APIKeyHash(key string) string {
+	return hashToken(key)
+}
+
+// IsAPIKey report whether key looks like an API key.
+func IsAPIKey(key string) bool {
+	return strings.HasPrefix(key, apiKeyPrefix)
+}
+
+// Active report whether the key is accepted at now.
+func (k *APIKey) Active(now time.Time) bool {
+	return !k.Revoked && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Scope returns the permissions among granted the key is scoped to.
+func (k *APIKey) Scope(granted []string) []string {
+	permissions := []string{}
+	for _, scope := range k.Scopes {
+		for _, permission := range granted {
+			if scope == permission {
+				permissions = append(permissions, scope)
+				break
+			}
+		}
+	}
+
+	return permissions
+}
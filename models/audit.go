@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Audited actions, named after the entity they change.
+const (
+	AuditAdminCreate    = "admin.create"
+	AuditUserSuspend    = "user.suspend"
+	AuditUserReactivate = "user.reactivate"
+	AuditUserLogout     = "user.logout"
+	AuditUserRoles      = "user.roles"
+	AuditUserBalance    = "user.balance"
+	AuditUserUnlock     = "user.unlock"
+)
+
+// AuditEntry is an append-only record of an administrative action. Actor is the admin
+// username, or a name prefixed with @ for actions not made through the API.
+type AuditEntry struct {
+	ID        string            `json:"id" bson:"_id"`
+	Actor     string            `json:"actor"`
+	Action    string            `json:"action"`
+	Target    string            `json:"target"`
+	Reason    string            `json:"reason,omitempty" bson:",omitempty"`
+	Details   map[string]string `json:"details,omitempty" bson:",omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+}
+
+// AuditQuery describe audit entries to list, newest first. Zero values disable the
+// corresponding filter.
+type AuditQuery struct {
+	Actor  string
+	Target string
+
+	// Before is the last entry of the previous page, only older entries match.
+	Before *AuditEntry
+	Limit  int
+}
+
+// AuditPage is a page of listed audit entries, NextCursor is empty on the last page.
+type AuditPage struct {
+	Entries    []*AuditEntry `json:"entries"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+func NewAuditEntry(actor string, action string, target string) *AuditEntry {
+	return &AuditEntry{
+		ID:        uuid.Must(uuid.NewUUID()).String(),
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// Matches report whether the entry satisfies the query filters, ordering is not considered.
+func (q *AuditQuery) Matches(e *AuditEntry) bool {
+	return (q.Actor == "" || e.Actor == q.Actor) && (q.Target == "" || e.Target == q.Target)
+}
+
+// Older report whether the entry was recorded before other, ties are ordered by ID.
+func (e *AuditEntry) Older(other *AuditEntry) bool {
+	if e.CreatedAt.Equal(other.CreatedAt) {
+		return e.ID < other.ID
+	}
+
+	return e.CreatedAt.Before(other.CreatedAt)
+}
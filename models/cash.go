@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidCoinCount = errors.New("coin counts must not be negative")
+
+const (
+	// CashCollection empties the cashbox of a machine, the coins counted by the route driver
+	// are recorded against the coins the cashbox was expected to hold.
+	CashCollection = "collection"
+
+	// CashFloatTopUp adds coins to the cassette of a machine so it can pay change.
+	CashFloatTopUp = "float"
+
+	// CashFloatUnload empties the cassette of a machine taken out of service for good.
+	CashFloatUnload = "unload"
+)
+
+// MachineCash holds the coins inside a machine. The cassette is the change float, coins are
+// paid out of it and deposited coins refill it up to its capacity, deposited coins it has no
+// room for drop into the cashbox which is only emptied by collections.
+type MachineCash struct {
+	MachineID string        `json:"machineId"`
+	Cassette  CoinInventory `json:"cassette"`
+	Cashbox   CoinInventory `json:"cashbox"`
+}
+
+// CashMovement records coins an operator took out of, or put into, a machine.
+type CashMovement struct {
+	ID        string        `json:"id" bson:"_id"`
+	MachineID string        `json:"machineId"`
+	Kind      string        `json:"kind"`
+	Operator  string        `json:"operator"`
+	Coins     CoinInventory `json:"coins"`
+	Amount    int           `json:"amount"`
+
+	// Expected is what the cashbox held when it was collected, Discrepancy is the amount
+	// counted minus the amount expected.
+	Expected    CoinInventory `json:"expected,omitempty" bson:",omitempty"`
+	Discrepancy int           `json:"discrepancy"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+// NewCashCollection returns the collection by operator of the coins counted out of a cashbox
+// expected to hold expected.
+func NewCashCollection(machineID string, operator string, counted CoinInventory, expected CoinInventory) *CashMovement {
+	movement := newCashMovement(machineID, CashCollection, operator, counted)
+	movement.Expected = expected
+	movement.Discrepancy = counted.Total() - expected.Total()
+
+	return movement
+}
+
+// NewFloatTopUp returns the top-up by operator of the machine cassette with coins.
+func NewFloatTopUp(machineID string, operator string, coins CoinInventory) *CashMovement {
+	return newCashMovement(machineID, CashFloatTopUp, operator, coins)
+}
+
+// NewFloatUnload returns the removal by operator of the coins left in the machine cassette.
+func NewFloatUnload(machineID string, operator string, coins CoinInventory) *CashMovement {
+	return newCashMovement(machineID, CashFloatUnload, operator, coins)
+}
+
+func newCashMovement(machineID string, kind string, operator string, coins CoinInventory) *CashMovement {
+	return &CashMovement{
+		ID:        uuid.Must(uuid.NewUUID()).String(),
+		MachineID: machineID,
+		Kind:      kind,
+		Operator:  operator,
+		Coins:     coins,
+		Amount:    coins.Total(),
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// CassetteID and CashboxID identify the coin inventories of the machine.
+func CassetteID(machineID string) string {
+	return machineID + "/cassette"
+}
+
+func CashboxID(machineID string) string {
+	return machineID + "/cashbox"
+}
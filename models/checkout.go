@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CartItem is a slot of the machine and the quantity of its product to buy at checkout.
+type CartItem struct {
+	Slot     string `json:"slot"`
+	Quantity int    `json:"quantity"`
+}
+
+// Checkout is the receipt of several products bought at once. Every line item is recorded
+// as an order carrying the checkout ID, the change is paid once for the whole checkout.
+type Checkout struct {
+	ID        string        `json:"id" bson:"_id"`
+	Buyer     string        `json:"buyer"`
+	MachineID string        `json:"machineId"`
+	Currency  string        `json:"currency"`
+	Items     []*Order      `json:"items"`
+	Total     int           `json:"total"`
+	Change    CoinInventory `json:"change"`
+	Balance   int           `json:"balance"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+// NewCheckout returns the checkout by the buyer of products from the slots of machine,
+// quantities[i] is the quantity bought of products[i] from slots[i].
+func NewCheckout(buyer string, machine *Machine, slots []string, products []*Product, quantities []int) *Checkout {
+	checkout := &Checkout{
+		ID:        uuid.Must(uuid.NewUUID()).String(),
+		Buyer:     buyer,
+		MachineID: machine.ID,
+		Currency:  machine.Currency,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	for i, product := range products {
+		order := NewOrder(buyer, product, quantities[i])
+		order.CheckoutID = checkout.ID
+		order.MachineID = machine.ID
+		order.Slot = slots[i]
+		order.Currency = machine.Currency
+		order.CreatedAt = checkout.CreatedAt
+
+		checkout.Items = append(checkout.Items, order)
+		checkout.Total += order.Total
+	}
+
+	return checkout
+}
+
+// MergeCartItems returns the normalized slot codes of the cart in first appearance order
+// with the total quantity of each, so a slot listed twice is bought from once.
+func MergeCartItems(items []CartItem) ([]string, map[string]int) {
+	codes := []string{}
+	quantities := map[string]int{}
+	for _, item := range items {
+		code := NormalizeSlotCode(item.Slot)
+		if _, ok := quantities[code]; !ok {
+			codes = append(codes, code)
+		}
+		quantities[code] += item.Quantity
+	}
+
+	return codes, quantities
+}
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"errors"
+	"sort"
+)
+
+var ErrExactChangeUnavailable = errors.New("Exact change cannot be made with the coins available")
+
+// unreachable marks amounts no combination of coins sums to.
+const unreachable = int(^uint(0) >> 1)
+
+// CoinInventory holds how many coins of each denomination are available.
+type CoinInventory map[int]int
+
+// NewCoinInventory returns inventory holding the given coins.
+func NewCoinInventory(coins Coins) CoinInventory {
+	inventory := CoinInventory{}
+	for _, coin := range coins {
+		inventory[coin]++
+	}
+
+	return inventory
+}
+
+// Total returns total amount held by the inventory.
+func (inv CoinInventory) Total() int {
+	total := 0
+	for coin, count := range inv {
+		total += coin * count
+	}
+
+	return total
+}
+
+// Negate returns inventory with every count negated, it is used to remove coins.
+func (inv CoinInventory) Negate() CoinInventory {
+	negated := make(CoinInventory, len(inv))
+	for coin, count := range inv {
+		negated[coin] = -count
+	}
+
+	return negated
+}
+
+// MakeChange returns the fewest coins taken from the inventory that sums exactly to amount,
+// it returns ErrExactChangeUnavailable when no combination of the available coins does.
+//
+// Coins are limited by their count in the inventory so this is solved as a bounded coin change
+// problem instead of the greedy approach which is only correct for unlimited canonical coin sets.
+func (inv CoinInventory) MakeChange(amount int) (CoinInventory, error) {
+	if amount < 0 {
+		return nil, ErrExactChangeUnavailable
+	}
+
+	if amount == 0 {
+		return CoinInventory{}, nil
+	}
+
+	// the tables below grow with amount, do not allocate them for amounts the coins held
+	// cannot cover anyway.
+	if amount > inv.Total() {
+		return nil, ErrExactChangeUnavailable
+	}
+
+	coins := make([]int, 0, len(inv))
+	for coin, count := range inv {
+		if coin > 0 && count > 0 {
+			coins = append(coins, coin)
+		}
+	}
+	sort.Ints(coins)
+
+	// best[a] is the fewest coins summing to a using the denominations processed so far and
+	// used[i][a] how many coins of coins[i] that solution takes.
+	best := make([]int, amount+1)
+	for a := 1; a <= amount; a++ {
+		best[a] = unreachable
+	}
+
+	used := make([][]int, len(coins))
+	for i, coin := range coins {
+		used[i] = boundedCoinStep(best, coin, inv[coin])
+	}
+
+	if best[amount] == unreachable {
+		return nil, ErrExactChangeUnavailable
+	}
+
+	change := CoinInventory{}
+	for i, a := len(coins)-1, amount; i >= 0; i-- {
+		if k := used[i][a]; k > 0 {
+			change[coins[i]] = k
+			a -= k * coins[i]
+		}
+	}
+
+	return change, nil
+}
+
+// boundedCoinStep update best in place allowing up to limit more coins of value coin, it
+// returns how many of those coins each updated amount uses.
+//
+// For amounts sharing the same remainder modulo coin, best[r+j*coin] becomes the minimum of
+// best[r+i*coin] + (j-i) for j-limit <= i <= j, which is found for every j in a single pass
+// using a monotonic queue over the values best[r+i*coin] - i.
+func boundedCoinStep(best []int, coin int, limit int) []int {
+	amount := len(best) - 1
+	used := make([]int, amount+1)
+	previous := make([]int, amount+1)
+	copy(previous, best)
+
+	for r := 0; r < coin && r <= amount; r++ {
+		queue := []int{}
+
+		for j := 0; r+j*coin <= amount; j++ {
+			a := r + j*coin
+
+			if previous[a] != unreachable {
+				for len(queue) > 0 {
+					last := queue[len(queue)-1]
+					if previous[r+last*coin]-last < previous[a]-j {
+						break
+					}
+					queue = queue[:len(queue)-1]
+				}
+				queue = append(queue, j)
+			}
+
+			for len(queue) > 0 && queue[0] < j-limit {
+				queue = queue[1:]
+			}
+
+			if len(queue) == 0 {
+				best[a] = unreachable
+				continue
+			}
+
+			i := queue[0]
+			best[a] = previous[r+i*coin] + (j - i)
+			used[a] = j - i
+		}
+	}
+
+	return used
+}
+
+// Split returns how coins are shared between the inventory, which holds up to capacity
+// coins of each denomination, and the overflow taking the coins it has no room for.
+func (inv CoinInventory) Split(coins CoinInventory, capacity int) (kept CoinInventory, overflow CoinInventory) {
+	kept, overflow = CoinInventory{}, CoinInventory{}
+	for coin, count := range coins {
+		room := capacity - inv[coin]
+		switch {
+		case room <= 0:
+			overflow[coin] = count
+		case count > room:
+			kept[coin], overflow[coin] = room, count-room
+		default:
+			kept[coin] = count
+		}
+	}
+
+	return kept, overflow
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeChange(t *testing.T) {
+	testCases := []struct {
+		inventory CoinInventory
+		amount    int
+		change    CoinInventory
+		err       error
+	}{
+		{
+			inventory: CoinInventory{5: 10, 10: 10, 20: 10, 50: 10, 100: 10},
+			amount:    185,
+			change:    CoinInventory{100: 1, 50: 1, 20: 1, 10: 1, 5: 1},
+		},
+		{
+			// greedy would take the 50 coin and fail to pay the remaining 10.
+			inventory: CoinInventory{20: 3, 50: 1},
+			amount:    60,
+			change:    CoinInventory{20: 3},
+		},
+		{
+			inventory: CoinInventory{10: 5, 20: 3, 50: 2},
+			amount:    60,
+			change:    CoinInventory{50: 1, 10: 1},
+		},
+		{
+			inventory: CoinInventory{5: 1, 10: 2},
+			amount:    30,
+			err:       ErrExactChangeUnavailable,
+		},
+		{
+			inventory: CoinInventory{5: 2, 20: 1},
+			amount:    15,
+			err:       ErrExactChangeUnavailable,
+		},
+		{
+			inventory: CoinInventory{5: 40},
+			amount:    100,
+			change:    CoinInventory{5: 20},
+		},
+		{
+			inventory: CoinInventory{},
+			amount:    0,
+			change:    CoinInventory{},
+		},
+		{
+			inventory: CoinInventory{5: 1, 100: 2},
+			amount:    1 << 40,
+			err:       ErrExactChangeUnavailable,
+		},
+	}
+
+	for _, test := range testCases {
+		change, err := test.inventory.MakeChange(test.amount)
+		assert.Equal(t, test.err, err)
+		assert.Equal(t, test.change, change)
+
+		if err == nil {
+			assert.Equal(t, test.amount, change.Total())
+		}
+	}
+}
+
+func TestSplitCoins(t *testing.T) {
+	cassette := CoinInventory{5: 2, 10: 4, 20: 1}
+
+	kept, overflow := cassette.Split(CoinInventory{5: 1, 10: 3, 50: 6}, 4)
+	assert.Equal(t, CoinInventory{5: 1, 50: 4}, kept)
+	assert.Equal(t, CoinInventory{10: 3, 50: 2}, overflow)
+}
@@ -0,0 +1,155 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// DefaultCurrencyCode is the currency of machines unless another one is configured.
+const DefaultCurrencyCode = "EUR"
+
+var currencyCodePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// Currency lists the denominations a machine accepts in its smallest unit, for example cents.
+// Coins are paid back as change, banknotes are only accepted and drop into the cashbox.
+type Currency struct {
+	Code      string `json:"code"`
+	Coins     []int  `json:"coins"`
+	Banknotes []int  `json:"banknotes,omitempty"`
+}
+
+// Currencies maps currency codes to their denominations.
+type Currencies map[string]*Currency
+
+// DefaultCurrencies returns the euro coins from 5 cents to 1 euro, used unless currencies are
+// configured.
+func DefaultCurrencies() Currencies {
+	return Currencies{
+		DefaultCurrencyCode: {Code: DefaultCurrencyCode, Coins: []int{5, 10, 20, 50, 100}},
+	}
+}
+
+// Validate check every currency has an ISO 4217 like code matching its key, at least one
+// coin and distinct positive denominations. Denominations are sorted in place.
+func (c Currencies) Validate() error {
+	for code, currency := range c {
+		if currency == nil {
+			return fmt.Errorf("currency %q has no denominations", code)
+		}
+
+		if currency.Code == "" {
+			currency.Code = code
+		}
+
+		if currency.Code != code || !currencyCodePattern.MatchString(code) {
+			return fmt.Errorf("invalid currency code %q", code)
+		}
+
+		if len(currency.Coins) == 0 {
+			return fmt.Errorf("currency %q has no coins", code)
+		}
+
+		sort.Ints(currency.Coins)
+		sort.Ints(currency.Banknotes)
+
+		seen := map[int]bool{}
+		for _, denomination := range append(append([]int{}, currency.Coins...), currency.Banknotes...) {
+			if denomination <= 0 || seen[denomination] {
+				return fmt.Errorf("currency %q has invalid or repeated denomination %d", code, denomination)
+			}
+			seen[denomination] = true
+		}
+	}
+
+	return nil
+}
+
+// IsCoin report whether denomination is one of the currency coins.
+func (c *Currency) IsCoin(denomination int) bool {
+	for _, coin := range c.Coins {
+		if coin == denomination {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Accepts report whether denomination is one of the currency coins or banknotes.
+func (c *Currency) Accepts(denomination int) bool {
+	if c.IsCoin(denomination) {
+		return true
+	}
+
+	for _, note := range c.Banknotes {
+		if note == denomination {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Unit returns the smallest amount every amount payable in the currency is a multiple of.
+func (c *Currency) Unit() int {
+	unit := 0
+	for _, denomination := range append(append([]int{}, c.Coins...), c.Banknotes...) {
+		unit = gcd(unit, denomination)
+	}
+
+	return unit
+}
+
+// Check reject money holding denominations the currency does not accept, or banknotes
+// unless banknotes is set, and counts below zero.
+func (c *Currency) Check(money CoinInventory, banknotes bool) error {
+	for denomination, count := range money {
+		if !c.IsCoin(denomination) && !(banknotes && c.Accepts(denomination)) {
+			return ErrCoinNotAccepted
+		}
+
+		if count < 0 {
+			return ErrInvalidCoinCount
+		}
+	}
+
+	return nil
+}
+
+// SplitBanknotes returns the coins and the banknotes of money.
+func (c *Currency) SplitBanknotes(money CoinInventory) (coins CoinInventory, banknotes CoinInventory) {
+	coins, banknotes = CoinInventory{}, CoinInventory{}
+	for denomination, count := range money {
+		if c.IsCoin(denomination) {
+			coins[denomination] = count
+		} else {
+			banknotes[denomination] = count
+		}
+	}
+
+	return coins, banknotes
+}
+
+// Counts returns the count of each coin of the currency in inv ordered from the smallest
+// coin, or nil when inv is empty.
+func (c *Currency) Counts(inv CoinInventory) []int {
+	if inv.Total() == 0 {
+		return nil
+	}
+
+	counts := make([]int, len(c.Coins))
+	for i, coin := range c.Coins {
+		counts[i] = inv[coin]
+	}
+
+	return counts
+}
+
+func gcd(a int, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrency(t *testing.T) {
+	currencies := Currencies{"CHF": {Coins: []int{500, 10, 20, 50, 100, 200}, Banknotes: []int{2000, 1000}}}
+	assert.NoError(t, currencies.Validate())
+
+	chf := currencies["CHF"]
+	assert.Equal(t, "CHF", chf.Code)
+	assert.Equal(t, []int{10, 20, 50, 100, 200, 500}, chf.Coins)
+	assert.Equal(t, 10, chf.Unit())
+
+	assert.True(t, chf.Accepts(1000))
+	assert.False(t, chf.IsCoin(1000))
+	assert.False(t, chf.Accepts(5))
+
+	assert.NoError(t, chf.Check(CoinInventory{10: 2, 1000: 1}, true))
+	assert.Equal(t, ErrCoinNotAccepted, chf.Check(CoinInventory{10: 2, 1000: 1}, false))
+	assert.Equal(t, ErrInvalidCoinCount, chf.Check(CoinInventory{10: -1}, false))
+
+	coins, banknotes := chf.SplitBanknotes(CoinInventory{10: 2, 1000: 1})
+	assert.Equal(t, CoinInventory{10: 2}, coins)
+	assert.Equal(t, CoinInventory{1000: 1}, banknotes)
+
+	assert.Equal(t, []int{2, 0, 0, 0, 0, 1}, chf.Counts(CoinInventory{10: 2, 500: 1}))
+	assert.Nil(t, chf.Counts(CoinInventory{}))
+
+	for _, invalid := range []Currencies{
+		{"chf": {Coins: []int{10}}},
+		{"CHF": {Code: "EUR", Coins: []int{10}}},
+		{"CHF": {Banknotes: []int{1000}}},
+		{"CHF": {Coins: []int{10, 10}}},
+		{"CHF": {Coins: []int{10}, Banknotes: []int{0}}},
+	} {
+		assert.Error(t, invalid.Validate())
+	}
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotentRequest remembers a request made with an Idempotency-Key so retries of the
+// request get the original response instead of applying it again. Keys are scoped to the
+// user, the ID is derived from both.
+type IdempotentRequest struct {
+	ID          string    `json:"id" bson:"_id"`
+	Username    string    `json:"username"`
+	RequestHash string    `json:"requestHash"`
+	Completed   bool      `json:"completed"`
+	CreatedAt   time.Time `json:"createdAt"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+
+	// Lease identify the attempt running the pending request, a retry may take the request
+	// over with a new lease once LeaseExpiresAt has passed.
+	Lease          string    `json:"lease"`
+	LeaseExpiresAt time.Time `json:"leaseExpiresAt"`
+
+	// Response of the request, set once it is completed.
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// NewIdempotentRequest returns the pending request of the user made with key, it is
+// remembered for ttl and leased to the attempt creating it for lease.
+func NewIdempotentRequest(username string, key string, requestHash string, ttl time.Duration, lease time.Duration) *IdempotentRequest {
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	return &IdempotentRequest{
+		ID:             IdempotentRequestID(username, key),
+		Username:       username,
+		RequestHash:    requestHash,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ttl),
+		Lease:          uuid.Must(uuid.NewRandom()).String(),
+		LeaseExpiresAt: now.Add(lease),
+	}
+}
+
+// IdempotentRequestID returns the ID of the request the user made with key.
+func IdempotentRequestID(username string, key string) string {
+	return hashToken(username + "\n" + key)
+}
+
+// RequestHash returns the hash identifying a request by its method, path and body.
+func RequestHash(method string, path string, body []byte) string {
+	return hashToken(method + " " + path + "\n" + string(body))
+}
+
+// Expired report whether the request is forgotten at now.
+func (r *IdempotentRequest) Expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// Leased report whether the request is still pending and held by its lease at now.
+func (r *IdempotentRequest) Leased(now time.Time) bool {
+	return !r.Completed && now.Before(r.LeaseExpiresAt)
+}
+
+// Complete record the response of the request.
+func (r *IdempotentRequest) Complete(status int, contentType string, body []byte) {
+	r.Completed = true
+	r.Status = status
+	r.ContentType = contentType
+	r.Body = body
+}
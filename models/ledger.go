@@ -0,0 +1,314 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// LedgerDeposit moves coins inserted by a buyer into the buyer balance.
+	LedgerDeposit = "deposit"
+
+	// LedgerPurchase moves the cost of a purchase from the buyer to the seller earnings.
+	LedgerPurchase = "purchase"
+
+	// LedgerRefund moves a buyer balance back out of the machine as coins, either as change
+	// after a purchase or when the deposit is reset.
+	LedgerRefund = "refund"
+
+	// LedgerPayout moves money withdrawn by a seller out of the seller earnings.
+	LedgerPayout = "payout"
+
+	// LedgerAdjustment is a manual correction of a user balance.
+	LedgerAdjustment = "adjustment"
+)
+
+// System accounts are the counterparty of money entering or leaving user balances, they are
+// prefixed with @ which is never part of a username. Like user accounts, they hold a separate
+// balance in each currency.
+const (
+	// CashAccount is the cash held by the machine, credits to buyers are debited from it.
+	CashAccount = "@cash"
+
+	// PayoutsAccount collects every seller payout.
+	PayoutsAccount = "@payouts"
+
+	// AdjustmentsAccount is the counterparty of manual balance adjustments.
+	AdjustmentsAccount = "@adjustments"
+
+	// earningsAccountPrefix prefix the account of each seller earnings.
+	earningsAccountPrefix = "@earnings:"
+)
+
+// EarningsAccount returns the ledger account of the seller earnings, it is kept apart from
+// the seller deposit account which is named after the seller.
+func EarningsAccount(seller string) string {
+	return earningsAccountPrefix + seller
+}
+
+// LedgerEntry is an append-only record of money credited to, or debited from, an account.
+// Amount is positive for credits and negative for debits so the account balance is the sum
+// of its entries.
+//
+// Amounts are in the smallest unit of Currency, the balance of an account is kept for each
+// currency on its own. Entries are recorded in balanced transactions, entries sharing a
+// TransactionID always sum to zero in each currency so every amount credited to an account
+// is debited from another.
+type LedgerEntry struct {
+	ID            string    `json:"id" bson:"_id"`
+	TransactionID string    `json:"transactionId"`
+	Account       string    `json:"account"`
+	Kind          string    `json:"kind"`
+	Amount        int       `json:"amount"`
+	Currency      string    `json:"currency"`
+	OrderID       string    `json:"orderId,omitempty" bson:",omitempty"`
+	ProductID     string    `json:"productId,omitempty" bson:",omitempty"`
+	ProductName   string    `json:"productName,omitempty" bson:",omitempty"`
+	Quantity      int       `json:"quantity,omitempty" bson:",omitempty"`
+	Reason        string    `json:"reason,omitempty" bson:",omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// newLedgerTransaction returns a balanced pair of entries moving amount of currency from
+// account debited to account credited.
+func newLedgerTransaction(kind string, currency string, debited string, credited string, amount int) []*LedgerEntry {
+	transactionID := uuid.Must(uuid.NewUUID()).String()
+	createdAt := time.Now().UTC().Truncate(time.Millisecond)
+
+	return []*LedgerEntry{
+		{
+			ID:            uuid.Must(uuid.NewUUID()).String(),
+			TransactionID: transactionID,
+			Account:       debited,
+			Kind:          kind,
+			Amount:        -amount,
+			Currency:      currency,
+			CreatedAt:     createdAt,
+		},
+		{
+			ID:            uuid.Must(uuid.NewUUID()).String(),
+			TransactionID: transactionID,
+			Account:       credited,
+			Kind:          kind,
+			Amount:        amount,
+			Currency:      currency,
+			CreatedAt:     createdAt,
+		},
+	}
+}
+
+// NewDepositTransaction credits the buyer with deposited amount taken in by the machine.
+func NewDepositTransaction(buyer string, currency string, amount int) []*LedgerEntry {
+	return newLedgerTransaction(LedgerDeposit, currency, CashAccount, buyer, amount)
+}
+
+// NewPurchaseTransaction moves the order total from the buyer to the earnings of the seller of
+// the product, in the currency of the order.
+func NewPurchaseTransaction(order *Order) []*LedgerEntry {
+	entries := newLedgerTransaction(LedgerPurchase, order.Currency, order.Buyer, EarningsAccount(order.Product.SellerId), order.Total)
+	for _, entry := range entries {
+		entry.OrderID = order.ID
+		entry.ProductID = order.Product.ID
+		entry.ProductName = order.Product.Name
+		entry.Quantity = order.Quantity
+		entry.CreatedAt = order.CreatedAt
+	}
+
+	return entries
+}
+
+// NewRefundTransaction debits the buyer with amount paid back as coins by the machine, orderID
+// is set when the refund is the change of a purchase to the ID of the order or checkout.
+func NewRefundTransaction(buyer string, currency string, amount int, orderID string) []*LedgerEntry {
+	entries := newLedgerTransaction(LedgerRefund, currency, buyer, CashAccount, amount)
+	for _, entry := range entries {
+		entry.OrderID = orderID
+	}
+
+	return entries
+}
+
+// NewPayoutTransaction debits the seller earnings with the amount withdrawn in currency.
+func NewPayoutTransaction(seller string, currency string, amount int) []*LedgerEntry {
+	return newLedgerTransaction(LedgerPayout, currency, EarningsAccount(seller), PayoutsAccount, amount)
+}
+
+// Reason codes of manual balance adjustments.
+const (
+	AdjustmentCorrection = "correction"
+	AdjustmentGoodwill   = "goodwill"
+	AdjustmentRefund     = "refund"
+	AdjustmentChargeback = "chargeback"
+)
+
+// ValidAdjustmentReason report whether reason is a known adjustment reason code.
+func ValidAdjustmentReason(reason string) bool {
+	switch reason {
+	case AdjustmentCorrection, AdjustmentGoodwill, AdjustmentRefund, AdjustmentChargeback:
+		return true
+	}
+
+	return false
+}
+
+// NewAdjustmentTransaction credits the user with amount, or debits it when amount is
+// negative, against the adjustments account.
+func NewAdjustmentTransaction(username string, currency string, amount int, reason string) []*LedgerEntry {
+	entries := newLedgerTransaction(LedgerAdjustment, currency, AdjustmentsAccount, username, amount)
+	for _, entry := range entries {
+		entry.Reason = reason
+	}
+
+	return entries
+}
+
+// LedgerBalanced report whether entries sum to zero in every currency, amounts of different
+// currencies never offset each other.
+func LedgerBalanced(entries []*LedgerEntry) bool {
+	sums := map[string]int{}
+	for _, entry := range entries {
+		sums[entry.Currency] += entry.Amount
+	}
+
+	for _, sum := range sums {
+		if sum != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// LedgerBalances are the balances of ledger accounts, keyed by account then currency.
+type LedgerBalances map[string]map[string]int
+
+// Add amount of currency to the balance of account.
+func (b LedgerBalances) Add(account string, currency string, amount int) {
+	if b[account] == nil {
+		b[account] = map[string]int{}
+	}
+
+	b[account][currency] += amount
+}
+
+// Discrepancy is a stored user balance disagreeing with the balance of its ledger account in
+// the currency, Account is either the user deposit account or the seller earnings account.
+type Discrepancy struct {
+	Username string `json:"username"`
+	Account  string `json:"account"`
+	Currency string `json:"currency"`
+	Balance  int    `json:"balance"`
+	Ledger   int    `json:"ledger"`
+}
+
+// Reconciliation is the outcome of checking stored balances against the ledger, Imbalances
+// holds the sum of every ledger entry of the currencies not summing to zero, which only
+// happens when an unbalanced transaction was recorded.
+type Reconciliation struct {
+	Discrepancies []Discrepancy  `json:"discrepancies"`
+	Imbalances    map[string]int `json:"imbalances"`
+}
+
+// OK report whether balances and ledger agree.
+func (r *Reconciliation) OK() bool {
+	return len(r.Discrepancies) == 0 && len(r.Imbalances) == 0
+}
+
+// Earnings summarize a seller ledger in a single currency.
+type Earnings struct {
+	Currency     string            `json:"currency"`
+	Balance      int               `json:"balance"`
+	TotalSales   int               `json:"totalSales"`
+	TotalPayouts int               `json:"totalPayouts"`
+	Products     []ProductEarnings `json:"products"`
+	Days         []DailyEarnings   `json:"days"`
+}
+
+// ProductEarnings is the total sold of a single product.
+type ProductEarnings struct {
+	ProductID   string `json:"productId"`
+	ProductName string `json:"productName"`
+	Quantity    int    `json:"quantity"`
+	Amount      int    `json:"amount"`
+}
+
+// DailyEarnings is the total sold during a single UTC day formatted as YYYY-MM-DD.
+type DailyEarnings struct {
+	Date     string `json:"date"`
+	Quantity int    `json:"quantity"`
+	Amount   int    `json:"amount"`
+}
+
+// NewEarnings aggregate the entries of a seller earnings account in each currency, sales are
+// the purchases credited to it. Earnings are sorted by currency code, their products and days
+// by ID and date respectively.
+func NewEarnings(entries []*LedgerEntry) []*Earnings {
+	currencies := map[string][]*LedgerEntry{}
+	for _, entry := range entries {
+		currencies[entry.Currency] = append(currencies[entry.Currency], entry)
+	}
+
+	all := make([]*Earnings, 0, len(currencies))
+	for currency, entries := range currencies {
+		all = append(all, newCurrencyEarnings(currency, entries))
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Currency < all[j].Currency
+	})
+
+	return all
+}
+
+// newCurrencyEarnings aggregate earnings entries all in currency.
+func newCurrencyEarnings(currency string, entries []*LedgerEntry) *Earnings {
+	earnings := &Earnings{Currency: currency, Products: []ProductEarnings{}, Days: []DailyEarnings{}}
+
+	products := map[string]int{}
+	days := map[string]int{}
+
+	for _, entry := range entries {
+		earnings.Balance += entry.Amount
+
+		switch {
+		case entry.Kind == LedgerPayout:
+			earnings.TotalPayouts -= entry.Amount
+		case entry.Kind == LedgerPurchase && entry.Amount > 0:
+			earnings.TotalSales += entry.Amount
+
+			i, ok := products[entry.ProductID]
+			if !ok {
+				i = len(earnings.Products)
+				products[entry.ProductID] = i
+				earnings.Products = append(earnings.Products, ProductEarnings{ProductID: entry.ProductID})
+			}
+
+			earnings.Products[i].ProductName = entry.ProductName
+			earnings.Products[i].Quantity += entry.Quantity
+			earnings.Products[i].Amount += entry.Amount
+
+			date := entry.CreatedAt.UTC().Format("2006-01-02")
+			j, ok := days[date]
+			if !ok {
+				j = len(earnings.Days)
+				days[date] = j
+				earnings.Days = append(earnings.Days, DailyEarnings{Date: date})
+			}
+
+			earnings.Days[j].Quantity += entry.Quantity
+			earnings.Days[j].Amount += entry.Amount
+		}
+	}
+
+	sort.Slice(earnings.Products, func(i, j int) bool {
+		return earnings.Products[i].ProductID < earnings.Products[j].ProductID
+	})
+
+	sort.Slice(earnings.Days, func(i, j int) bool {
+		return earnings.Days[i].Date < earnings.Days[j].Date
+	})
+
+	return earnings
+}
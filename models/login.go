@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// LoginPolicy describe how failed logins are throttled. Every failure doubles the delay
+// before the next attempt starting at BaseDelay up to MaxDelay, once MaxFailures is reached
+// attempts are locked out for Lockout. Failures older than Lockout are forgotten.
+type LoginPolicy struct {
+	MaxFailures int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	Lockout     time.Duration
+}
+
+// LoginAttempts track failed logins of a single username or client IP.
+type LoginAttempts struct {
+	ID          string    `json:"id" bson:"_id"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+	LockedUntil time.Time `json:"lockedUntil"`
+}
+
+// UsernameAttempts returns the ID login attempts of the username are tracked under.
+func UsernameAttempts(username string) string {
+	return "username:" + username
+}
+
+// IPAttempts returns the ID login attempts from the client IP are tracked under.
+func IPAttempts(ip string) string {
+	return "ip:" + ip
+}
+
+// RetryAfter returns how long to wait before the next attempt is allowed, zero when an
+// attempt can be made now.
+func (a *LoginAttempts) RetryAfter(now time.Time) time.Duration {
+	if now.Before(a.LockedUntil) {
+		return a.LockedUntil.Sub(now)
+	}
+
+	return 0
+}
+
+// Fail record a failed attempt made at now and delay the next one.
+func (a *LoginAttempts) Fail(now time.Time, policy LoginPolicy) {
+	if a.Failures >= policy.MaxFailures || now.Sub(a.LastFailure) > policy.Lockout {
+		a.Failures = 0
+	}
+
+	a.Failures++
+	a.LastFailure = now
+
+	if a.Failures >= policy.MaxFailures {
+		a.LockedUntil = now.Add(policy.Lockout)
+		return
+	}
+
+	delay := policy.BaseDelay
+	for i := 1; i < a.Failures && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	a.LockedUntil = now.Add(delay)
+}
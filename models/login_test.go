@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginAttemptsBackoff(t *testing.T) {
+	policy := LoginPolicy{MaxFailures: 5, BaseDelay: time.Second, MaxDelay: 3 * time.Second, Lockout: time.Hour}
+	now := time.Now()
+	attempts := &LoginAttempts{ID: UsernameAttempts("buyer1")}
+
+	assert.Equal(t, time.Duration(0), attempts.RetryAfter(now))
+
+	for _, delay := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second, time.Hour} {
+		attempts.Fail(now, policy)
+		assert.Equal(t, delay, attempts.RetryAfter(now))
+
+		now = now.Add(delay)
+		assert.Equal(t, time.Duration(0), attempts.RetryAfter(now))
+	}
+
+	// the first failure after a lockout starts over.
+	attempts.Fail(now, policy)
+	assert.Equal(t, 1, attempts.Failures)
+	assert.Equal(t, time.Second, attempts.RetryAfter(now))
+
+	// so does a failure long after the previous one.
+	attempts.Fail(now.Add(time.Second), policy)
+	attempts.Fail(now.Add(2*time.Hour), policy)
+	assert.Equal(t, 1, attempts.Failures)
+}
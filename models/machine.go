@@ -0,0 +1,100 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MachineActive      = "active"
+	MachineMaintenance = "maintenance"
+	MachineRetired     = "retired"
+)
+
+// Machine is a physical vending machine, its stock is held in slots. Only active machines
+// sell products.
+type Machine struct {
+	ID        string    `json:"id" bson:"_id"`
+	Name      string    `json:"name"`
+	Location  string    `json:"location"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Currency is the code of the currency the machine accepts, it cannot be changed once
+	// the machine is created.
+	Currency string `json:"currency"`
+}
+
+// MachineUpdate holds machine fields to update, zero values are left unchanged.
+type MachineUpdate struct {
+	Name     string
+	Location string
+	Status   string
+}
+
+func NewMachine(name string, location string, currency string) *Machine {
+	return &Machine{
+		ID:        uuid.Must(uuid.NewUUID()).String(),
+		Name:      name,
+		Location:  location,
+		Currency:  currency,
+		Status:    MachineActive,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// ValidMachineStatus report whether status is one of the machine statuses.
+func ValidMachineStatus(status string) bool {
+	return status == MachineActive || status == MachineMaintenance || status == MachineRetired
+}
+
+// Slot is a position of a machine holding units of a single product, Count is the stock
+// of the product in the machine and never exceeds Capacity.
+type Slot struct {
+	ID        string `json:"-" bson:"_id"`
+	MachineID string `json:"machineId"`
+	Code      string `json:"code"`
+	ProductID string `json:"productId,omitempty"`
+	Capacity  int    `json:"capacity"`
+	Count     int    `json:"count"`
+}
+
+// SlotUpdate holds slot fields to update, zero values are left unchanged except Count
+// which is only left unchanged when nil since a slot can be emptied.
+type SlotUpdate struct {
+	ProductID string
+	Capacity  int
+	Count     *int
+}
+
+var slotCodePattern = regexp.MustCompile(`^[A-Z][0-9]{1,2}$`)
+
+func NewSlot(machineID string, code string, productID string, capacity int, count int) *Slot {
+	return &Slot{
+		ID:        SlotID(machineID, code),
+		MachineID: machineID,
+		Code:      code,
+		ProductID: productID,
+		Capacity:  capacity,
+		Count:     count,
+	}
+}
+
+// SlotID returns the ID of the slot of the machine with code.
+func SlotID(machineID string, code string) string {
+	return machineID + "/" + code
+}
+
+// NormalizeSlotCode returns the code in upper case, slot codes are case insensitive.
+func NormalizeSlotCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidSlotCode report whether the normalized code is a row letter followed by a column
+// number, for example A3.
+func ValidSlotCode(code string) bool {
+	return slotCodePattern.MatchString(code)
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Order is the receipt of a purchase, the product is a snapshot taken at purchase time.
+type Order struct {
+	ID        string        `json:"id" bson:"_id"`
+	Buyer     string        `json:"buyer"`
+	Product   Product       `json:"product"`
+	UnitCost  int           `json:"unitCost"`
+	Quantity  int           `json:"quantity"`
+	Total     int           `json:"total"`
+	Change    CoinInventory `json:"change"`
+	Balance   int           `json:"balance"`
+	CreatedAt time.Time     `json:"createdAt"`
+
+	// CheckoutID is set on line items of a checkout, the change of a checkout is on the
+	// checkout rather than on its orders.
+	CheckoutID string `json:"checkoutId,omitempty" bson:",omitempty"`
+
+	// MachineID and Slot tell where the product was sold from, amounts are in the Currency
+	// of the machine.
+	MachineID string `json:"machineId"`
+	Slot      string `json:"slot"`
+	Currency  string `json:"currency"`
+}
+
+// OrderQuery describe orders of a buyer to list, newest first.
+type OrderQuery struct {
+	Buyer string
+
+	// Before is the last order of the previous page, only older orders match.
+	Before *Order
+	Limit  int
+}
+
+// OrderPage is a page of listed orders, NextCursor is empty on the last page.
+type OrderPage struct {
+	Orders     []*Order `json:"orders"`
+	NextCursor string   `json:"nextCursor,omitempty"`
+}
+
+func NewOrder(buyer string, product *Product, quantity int) *Order {
+	return &Order{
+		ID:       uuid.Must(uuid.NewUUID()).String(),
+		Buyer:    buyer,
+		Product:  *product,
+		UnitCost: product.Cost,
+		Quantity: quantity,
+		Total:    product.Cost * quantity,
+		// stored timestamps have millisecond precision, truncate so pagination compares
+		// the same value whatever the storage backend.
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
+
+// Older report whether the order was placed before other, ties are ordered by ID.
+func (o *Order) Older(other *Order) bool {
+	if o.CreatedAt.Equal(other.CreatedAt) {
+		return o.ID < other.ID
+	}
+
+	return o.CreatedAt.Before(other.CreatedAt)
+}
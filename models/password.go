@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/base64"
+	"time"
+)
+
+// PasswordReset is a single-use token letting a user set a new password without the old
+// one, only the hash of the token is kept as ID.
+type PasswordReset struct {
+	ID        string    `json:"-" bson:"_id"`
+	Username  string    `json:"username"`
+	Used      bool      `json:"used"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// NewPasswordReset returns the password reset of the user with its token, the token is
+// valid for ttl.
+func NewPasswordReset(username string, ttl time.Duration) (*PasswordReset, string) {
+	token := base64.RawURLEncoding.EncodeToString(randomBytes(32))
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	return &PasswordReset{
+		ID:        PasswordResetID(token),
+		Username:  username,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}, token
+}
+
+// PasswordResetID returns the ID of the password reset the token was issued for.
+func PasswordResetID(token string) string {
+	return hashToken(token)
+}
@@ -0,0 +1,109 @@
+package models
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Character classes a PasswordPolicy can require.
+const (
+	ClassLower  = "lower"
+	ClassUpper  = "upper"
+	ClassDigit  = "digit"
+	ClassSymbol = "symbol"
+)
+
+const (
+	usernameMinLength = 3
+	usernameMaxLength = 32
+)
+
+//go:embed denylist.txt
+var commonPasswords string
+
+// PasswordPolicy describe passwords users are allowed to choose.
+type PasswordPolicy struct {
+	MinLength       int
+	RequiredClasses []string
+
+	// denylist holds lower cased passwords that are rejected whatever their strength.
+	denylist map[string]bool
+}
+
+// NewPasswordPolicy returns a policy denying the built-in common passwords in addition
+// to the given denylist, passwords are compared ignoring case.
+func NewPasswordPolicy(minLength int, requiredClasses []string, denylist []string) *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:       minLength,
+		RequiredClasses: requiredClasses,
+		denylist:        map[string]bool{},
+	}
+
+	for _, password := range append(strings.Fields(commonPasswords), denylist...) {
+		policy.denylist[strings.ToLower(password)] = true
+	}
+
+	return policy
+}
+
+// Check returns every rule the password breaks, none when it is allowed.
+func (p *PasswordPolicy) Check(password string) []string {
+	problems := []string{}
+
+	if len([]rune(password)) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters long", p.MinLength))
+	}
+
+	for _, class := range p.RequiredClasses {
+		if strings.IndexFunc(password, classMatcher(class)) < 0 {
+			problems = append(problems, fmt.Sprintf("must contain a %s character", class))
+		}
+	}
+
+	if p.denylist[strings.ToLower(password)] {
+		problems = append(problems, "is too common")
+	}
+
+	return problems
+}
+
+func classMatcher(class string) func(rune) bool {
+	switch class {
+	case ClassLower:
+		return unicode.IsLower
+	case ClassUpper:
+		return unicode.IsUpper
+	case ClassDigit:
+		return unicode.IsDigit
+	default:
+		return func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+		}
+	}
+}
+
+// NormalizeUsername returns the canonical form usernames are stored and looked up with.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// CheckUsername returns every rule a normalized username breaks, usernames are 3 to 32
+// lower case letters, digits, dots, dashes or underscores.
+func CheckUsername(username string) []string {
+	problems := []string{}
+
+	if len(username) < usernameMinLength || len(username) > usernameMaxLength {
+		problems = append(problems, fmt.Sprintf("must be %d to %d characters long", usernameMinLength, usernameMaxLength))
+	}
+
+	for _, r := range username {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '.' && r != '-' && r != '_' {
+			problems = append(problems, "may only contain letters, digits, dots, dashes and underscores")
+			break
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := NewPasswordPolicy(8, []string{ClassLower, ClassDigit, ClassSymbol}, []string{"Vending-pass1"})
+
+	testCases := []struct {
+		password string
+		problems []string
+	}{
+		{password: "coffee-machine7", problems: []string{}},
+		{password: "a1-", problems: []string{"must be at least 8 characters long"}},
+		{password: "coffeemachine", problems: []string{"must contain a digit character", "must contain a symbol character"}},
+		{password: "PASSWORD123", problems: []string{"must contain a lower character", "must contain a symbol character", "is too common"}},
+		{password: "vending-PASS1", problems: []string{"is too common"}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.problems, policy.Check(tc.password), tc.password)
+	}
+}
+
+func TestCheckUsername(t *testing.T) {
+	assert.Equal(t, "buyer1", NormalizeUsername(" Buyer1 "))
+
+	assert.Empty(t, CheckUsername("buyer_1.test-a"))
+	assert.Equal(t, []string{"must be 3 to 32 characters long"}, CheckUsername("ab"))
+	assert.Equal(t, []string{"may only contain letters, digits, dots, dashes and underscores"}, CheckUsername("buyer one"))
+}
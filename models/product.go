@@ -1,8 +1,7 @@
 package models
 
 import (
-	"errors"
-	"sort"
+	"strings"
 
 	"github.com/google/uuid"
 )
@@ -15,6 +14,13 @@ type Product struct {
 	SellerId  string `json:"sellerId"`
 }
 
+// ProductUpdate holds product fields to update, zero values are left unchanged.
+type ProductUpdate struct {
+	Name      string
+	Available int
+	Cost      int
+}
+
 func NewProduct(name string, available int, cost int, sellerId string) *Product {
 	return &Product{
 		ID:        uuid.Must(uuid.NewUUID()).String(),
@@ -25,40 +31,83 @@ func NewProduct(name string, available int, cost int, sellerId string) *Product
 	}
 }
 
-func (p *Product) Change(quatity int, amount int) ([]int, error) {
+const (
+	SortByName      = "name"
+	SortByCost      = "cost"
+	SortByAvailable = "available"
+)
 
-	totalSpent := p.Cost * quatity
+// ProductQuery describe filters and ordering used to list products. Zero values disable
+// the corresponding filter.
+type ProductQuery struct {
+	SellerID string
+	MinCost  int
+	MaxCost  int
+	InStock  bool
 
-	if totalSpent > amount {
-		return nil, errors.New("Insufficient balance to complete the purchase")
-	}
+	// Search matches products whose name contains it, ignoring case.
+	Search string
 
-	changeCoins := makeChange(amount - totalSpent)
+	// SortBy is one of SortByName, SortByCost or SortByAvailable, ties are ordered by ID.
+	SortBy     string
+	Descending bool
 
-	p.Available = p.Available - quatity
+	// After is the last product of the previous page, only products ordered after it match.
+	After *Product
+	Limit int
+}
 
-	return changeCoins, nil
+// ProductPage is a page of listed products, NextCursor is empty on the last page.
+type ProductPage struct {
+	Products   []*Product `json:"products"`
+	NextCursor string     `json:"nextCursor,omitempty"`
 }
 
-func makeChange(change int) []int {
-	if change == 0 {
-		return nil
+// Matches report whether product satisfies the query filters, ordering is not considered.
+func (q *ProductQuery) Matches(p *Product) bool {
+	if q.SellerID != "" && p.SellerId != q.SellerID {
+		return false
+	}
+
+	if q.MinCost != 0 && p.Cost < q.MinCost {
+		return false
 	}
 
-	coinsPool := make([]int, len(acceptedCoins))
+	if q.MaxCost != 0 && p.Cost > q.MaxCost {
+		return false
+	}
 
-	copy(coinsPool, acceptedCoins)
-	sort.Sort(sort.Reverse(sort.IntSlice(coinsPool)))
+	if q.InStock && p.Available <= 0 {
+		return false
+	}
+
+	if q.Search != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(q.Search)) {
+		return false
+	}
+
+	return true
+}
+
+// Less report whether product a is ordered before product b by the query sort.
+func (q *ProductQuery) Less(a, b *Product) bool {
+	var cmp int
+
+	switch q.SortBy {
+	case SortByCost:
+		cmp = a.Cost - b.Cost
+	case SortByAvailable:
+		cmp = a.Available - b.Available
+	default:
+		cmp = strings.Compare(a.Name, b.Name)
+	}
 
-	changeCoinCount := make([]int, len(coinsPool))
-	for i, coin := range coinsPool {
-		changeCoinCount[i] = change / coin
-		change = change - changeCoinCount[i]*coin
+	if cmp == 0 {
+		cmp = strings.Compare(a.ID, b.ID)
 	}
 
-	for i, j := 0, len(changeCoinCount)-1; i < j; i, j = i+1, j-1 {
-		changeCoinCount[i], changeCoinCount[j] = changeCoinCount[j], changeCoinCount[i]
+	if q.Descending {
+		return cmp > 0
 	}
 
-	return changeCoinCount
+	return cmp < 0
 }
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Refund records deposit balance returned to a buyer as coins.
+type Refund struct {
+	ID        string        `json:"id" bson:"_id"`
+	Username  string        `json:"username"`
+	MachineID string        `json:"machineId"`
+	Currency  string        `json:"currency"`
+	Amount    int           `json:"amount"`
+	Coins     CoinInventory `json:"coins"`
+	CreatedAt time.Time     `json:"createdAt"`
+}
+
+func NewRefund(username string, machine *Machine, coins CoinInventory) *Refund {
+	return &Refund{
+		ID:        uuid.Must(uuid.NewUUID()).String(),
+		Username:  username,
+		MachineID: machine.ID,
+		Currency:  machine.Currency,
+		Amount:    coins.Total(),
+		Coins:     coins,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+}
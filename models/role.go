@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Permissions granted by roles, routes declare the permission they require.
+const (
+	PermProductWrite  = "product:write"
+	PermDepositCreate = "deposit:create"
+	PermOrderCreate   = "order:create"
+	PermOrderRead     = "order:read"
+	PermSalesRead     = "sales:read"
+	PermPayoutCreate  = "payout:create"
+	PermUserAdmin     = "user:admin"
+	PermAuditRead     = "audit:read"
+	PermMachineWrite  = "machine:write"
+)
+
+var knownPermissions = map[string]bool{
+	PermProductWrite:  true,
+	PermDepositCreate: true,
+	PermOrderCreate:   true,
+	PermOrderRead:     true,
+	PermSalesRead:     true,
+	PermPayoutCreate:  true,
+	PermUserAdmin:     true,
+	PermAuditRead:     true,
+	PermMachineWrite:  true,
+}
+
+// Roles maps role names to the permissions they grant.
+type Roles map[string][]string
+
+// DefaultRoles returns the buyer, seller, operator and admin roles used unless roles are
+// configured.
+func DefaultRoles() Roles {
+	return Roles{
+		"buyer":    {PermDepositCreate, PermOrderCreate, PermOrderRead},
+		"seller":   {PermProductWrite, PermSalesRead, PermPayoutCreate},
+		"operator": {PermMachineWrite},
+		"admin":    {PermUserAdmin, PermAuditRead},
+	}
+}
+
+// Validate check every role grants known permissions only.
+func (r Roles) Validate() error {
+	for role, permissions := range r {
+		for _, permission := range permissions {
+			if !knownPermissions[permission] {
+				return fmt.Errorf("role %q grants unknown permission %q", role, permission)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Valid report whether role is defined.
+func (r Roles) Valid(role string) bool {
+	_, ok := r[role]
+	return ok
+}
+
+// Grants report whether role grants the permission.
+func (r Roles) Grants(role string, permission string) bool {
+	for _, p := range r[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Permissions returns the sorted union of the permissions granted by roles, unknown roles
+// grant nothing.
+func (r Roles) Permissions(roles []string) []string {
+	set := map[string]bool{}
+	for _, role := range roles {
+		for _, permission := range r[role] {
+			set[permission] = true
+		}
+	}
+
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+
+	return permissions
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolePermissions(t *testing.T) {
+	roles := DefaultRoles()
+	assert.NoError(t, roles.Validate())
+
+	assert.Equal(t, []string{PermDepositCreate, PermOrderCreate, PermOrderRead}, roles.Permissions([]string{"buyer"}))
+	assert.Equal(t, []string{PermDepositCreate, PermOrderCreate, PermOrderRead, PermPayoutCreate, PermProductWrite, PermSalesRead},
+		roles.Permissions([]string{"buyer", "seller", "unknown"}))
+
+	assert.True(t, roles.Grants("seller", PermProductWrite))
+	assert.False(t, roles.Grants("buyer", PermProductWrite))
+	assert.False(t, roles.Valid("auditor"))
+
+	roles["auditor"] = []string{"machine:fly"}
+	assert.Error(t, roles.Validate())
+
+	user, err := NewUser("trader1", "vending-pass1", []string{"buyer", "seller", "buyer"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"buyer", "seller"}, user.Roles)
+	assert.True(t, user.HasRole("seller"))
+}
@@ -1,11 +1,103 @@
 package models
 
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SessionActive   = "active"
+	SessionInactive = "inactive"
+)
+
+// Session is a single login of a user, its ID is carried by the tokens issued for it so
+// each device can be logged out on its own.
+//
+// Access tokens of a session are short lived and renewed with its refresh token, every
+// refresh rotates the refresh token. Only hashes of refresh tokens are kept, the one
+// rotated last is remembered so presenting it again can be detected. Older refresh tokens
+// are simply rejected, remembering each of them would grow the session with every refresh.
 type Session struct {
-	Username string `json:"username"`
-	Token    string `json:"token"`
-	Status   string `json:"status"`
+	ID        string    `json:"id" bson:"_id"`
+	Username  string    `json:"username"`
+	Status    string    `json:"status"`
+	UserAgent string    `json:"userAgent"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// ExpiresAt is when the current refresh token stop being accepted.
+	ExpiresAt            time.Time `json:"expiresAt"`
+	RefreshToken         string    `json:"-"`
+	PreviousRefreshToken string    `json:"-"`
+}
+
+// NewSession returns the session with the refresh token issued for it, the refresh token
+// is valid for ttl.
+func NewSession(username string, userAgent string, ip string, ttl time.Duration) (*Session, string) {
+	session := &Session{
+		ID:        uuid.Must(uuid.NewUUID()).String(),
+		Username:  username,
+		Status:    SessionActive,
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+
+	token := session.issueRefreshToken(ttl)
+
+	return session, token
+}
+
+// RotateRefreshToken issue a new refresh token valid for ttl, the current one is
+// remembered as the previous refresh token.
+func (s *Session) RotateRefreshToken(ttl time.Duration) string {
+	s.PreviousRefreshToken = s.RefreshToken
+
+	return s.issueRefreshToken(ttl)
+}
+
+// MatchRefreshToken check whether token is the current refresh token of the session.
+func (s *Session) MatchRefreshToken(token string) bool {
+	return s.RefreshToken == hashToken(token)
+}
+
+// UsedRefreshToken check whether token is the refresh token the session rotated last.
+func (s *Session) UsedRefreshToken(token string) bool {
+	return s.PreviousRefreshToken != "" && s.PreviousRefreshToken == hashToken(token)
+}
+
+// Expired check whether the current refresh token of the session has expired.
+func (s *Session) Expired() bool {
+	return !time.Now().Before(s.ExpiresAt)
+}
+
+func (s *Session) issueRefreshToken(ttl time.Duration) string {
+	token := s.ID + "." + base64.RawURLEncoding.EncodeToString(randomBytes(32))
+
+	s.RefreshToken = hashToken(token)
+	s.ExpiresAt = time.Now().UTC().Add(ttl).Truncate(time.Millisecond)
+
+	return token
+}
+
+// RefreshTokenSession returns the ID of the session a refresh token was issued for.
+func RefreshTokenSession(token string) (string, bool) {
+	i := strings.LastIndex(token, ".")
+	if i <= 0 {
+		return "", false
+	}
+
+	return token[:i], true
 }
 
-func NewSession(username string, token string) *Session {
-	return &Session{Username: username, Token: token, Status: "active"}
+// hashToken returns the hex encoded sha256 hash of the token, refresh tokens are random
+// so a fast hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
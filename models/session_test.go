@@ -0,0 +1,24 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionRotateRefreshToken(t *testing.T) {
+	session, first := NewSession("buyer1", "", "", time.Hour)
+	assert.True(t, session.MatchRefreshToken(first))
+	assert.False(t, session.UsedRefreshToken(first))
+
+	second := session.RotateRefreshToken(time.Hour)
+	third := session.RotateRefreshToken(time.Hour)
+
+	assert.True(t, session.MatchRefreshToken(third))
+	assert.True(t, session.UsedRefreshToken(second))
+
+	// only the refresh token rotated last is remembered.
+	assert.False(t, session.MatchRefreshToken(first))
+	assert.False(t, session.UsedRefreshToken(first))
+}
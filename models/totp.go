@@ -0,0 +1,160 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits = 6
+	totpPeriod = 30
+
+	// totpSkew is how many periods before and after the current one are accepted, to
+	// tolerate clock drift of the authenticator device.
+	totpSkew = 1
+
+	recoveryCodeCount = 10
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTP holds the RFC 6238 second factor of a user. The secret is kept until the user
+// confirms the enrolment with a valid code, only then the second factor is enabled.
+type TOTP struct {
+	Enabled bool   `json:"enabled"`
+	Secret  string `json:"-"`
+
+	// LastStep is the time step of the last accepted code, a code is accepted once.
+	LastStep int64 `json:"-"`
+
+	// RecoveryCodes are hashes of the one-time codes usable in place of a TOTP code.
+	RecoveryCodes []string `json:"-"`
+}
+
+// TOTPEnrolment is what an authenticator app needs to generate codes of a new secret.
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// NewTOTPSecret returns a random base32 encoded 160 bits secret.
+func NewTOTPSecret() string {
+	return totpEncoding.EncodeToString(randomBytes(20))
+}
+
+// TOTPURI returns the otpauth URI authenticator apps enrol the secret with.
+func TOTPURI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// TOTPCode returns the code of the secret for the time step, as defined by RFC 4226 and
+// RFC 6238 using HMAC-SHA1 and 6 digits.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+// TOTPStep returns the time step the moment falls in.
+func TOTPStep(now time.Time) int64 {
+	return now.Unix() / totpPeriod
+}
+
+// VerifyTOTP check the code against the user secret at now, a code of a step already
+// used is rejected so an intercepted code cannot be replayed.
+func (u *User) VerifyTOTP(code string, now time.Time) bool {
+	if u.TOTP.Secret == "" {
+		return false
+	}
+
+	current := TOTPStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= u.TOTP.LastStep {
+			continue
+		}
+
+		expected, err := TOTPCode(u.TOTP.Secret, step)
+		if err != nil {
+			return false
+		}
+
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			u.TOTP.LastStep = step
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewRecoveryCodes replace the user recovery codes and returns the new ones in
+// plaintext, only their hashes are kept.
+func (u *User) NewRecoveryCodes() []string {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		code := strings.ToLower(totpEncoding.EncodeToString(randomBytes(5)))
+		codes[i] = code[:4] + "-" + code[4:]
+		hashes[i] = hashToken(codes[i])
+	}
+
+	u.TOTP.RecoveryCodes = hashes
+
+	return codes
+}
+
+// UseRecoveryCode consume the recovery code, it report false when the code is unknown or
+// already used.
+func (u *User) UseRecoveryCode(code string) bool {
+	hash := hashToken(strings.ToLower(strings.TrimSpace(code)))
+
+	for i, stored := range u.TOTP.RecoveryCodes {
+		if hmac.Equal([]byte(stored), []byte(hash)) {
+			remaining := make([]string, 0, len(u.TOTP.RecoveryCodes)-1)
+			remaining = append(remaining, u.TOTP.RecoveryCodes[:i]...)
+			u.TOTP.RecoveryCodes = append(remaining, u.TOTP.RecoveryCodes[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return b
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B SHA1 test vectors, truncated to 6 digits.
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	testCases := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tc := range testCases {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(tc.unix, 0)))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.code, code)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	user := &User{Username: "seller1", TOTP: TOTP{Secret: NewTOTPSecret()}}
+	now := time.Now()
+
+	code, err := TOTPCode(user.TOTP.Secret, TOTPStep(now))
+	assert.NoError(t, err)
+
+	assert.False(t, user.VerifyTOTP("000000", now.Add(time.Hour)))
+	assert.True(t, user.VerifyTOTP(code, now))
+
+	// a code is accepted once.
+	assert.False(t, user.VerifyTOTP(code, now))
+
+	codes := user.NewRecoveryCodes()
+	assert.Len(t, codes, recoveryCodeCount)
+	assert.NotContains(t, user.TOTP.RecoveryCodes, codes[0])
+
+	assert.True(t, user.UseRecoveryCode(codes[3]))
+	assert.False(t, user.UseRecoveryCode(codes[3]))
+	assert.Len(t, user.TOTP.RecoveryCodes, recoveryCodeCount-1)
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"errors"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -10,52 +11,133 @@ type User struct {
 	Username string `json:"username"`
 	Password string `json:"-"`
 	Deposit  int    `json:"deposit"`
-	Role     string `json:"role"`
+	TOTP     TOTP   `json:"totp"`
+
+	// DepositMachine is the machine the deposit was inserted into and DepositCurrency the
+	// currency it is counted in, the deposit can only be spent or refunded at that machine
+	// while it takes that currency. They are left over once the deposit is zero and then
+	// replaced by the next machine the user deposits into.
+	DepositMachine  string `json:"depositMachine,omitempty" bson:",omitempty"`
+	DepositCurrency string `json:"depositCurrency,omitempty" bson:",omitempty"`
+
+	// Earnings are the seller balances keyed by currency code, sales are credited to the
+	// currency of the machine selling and payouts withdraw from a single currency. They are
+	// kept apart from Deposit so they can never be spent on purchases.
+	Earnings map[string]int `json:"earnings,omitempty" bson:",omitempty"`
+
+	// Roles name the permission sets granted to the user, see Roles.
+	Roles []string `json:"roles"`
+
+	// Suspended users cannot login until an admin reactivate them.
+	Suspended bool `json:"suspended"`
+}
+
+// UserUpdate holds user fields to update, zero values are left unchanged.
+type UserUpdate struct {
+	Password string
+	Roles    []string
+}
+
+// UserPage is a page of listed users, NextCursor is empty on the last page.
+type UserPage struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// UserQuery describe users to list ordered by username. Zero values disable the
+// corresponding filter.
+type UserQuery struct {
+	// Search matches users whose username contains it, ignoring case.
+	Search string
+
+	// DepositMachine matches users holding a non-zero deposit in the machine.
+	DepositMachine string
+
+	// After is the last username of the previous page, only usernames ordered after it match.
+	After string
+	Limit int
+}
+
+// Matches report whether user satisfies the query filters, ordering is not considered.
+func (q *UserQuery) Matches(u *User) bool {
+	if q.DepositMachine != "" && (u.Deposit == 0 || u.DepositMachine != q.DepositMachine) {
+		return false
+	}
+
+	return q.Search == "" || strings.Contains(strings.ToLower(u.Username), strings.ToLower(q.Search))
 }
 
 type Coins []int
 
 var (
-	acceptedCoinsMap = map[int]bool{
-		5:   true,
-		10:  true,
-		20:  true,
-		50:  true,
-		100: true,
-	}
-	acceptedCoins = []int{5, 10, 20, 50, 100}
+	ErrCoinNotAccepted = errors.New("Coin not accepted")
 )
 
-func NewUser(username string, password string, role string) (*User, error) {
+// NewUser returns a user holding roles, roles are validated against the configured Roles
+// by the caller.
+func NewUser(username string, password string, roles []string) (*User, error) {
 
 	pwd, err := hashPassword(password)
 	if err != nil {
 		return nil, err
 	}
 
-	if role != "buyer" && role != "seller" {
-		return nil, errors.New("unknown role type")
+	if len(roles) == 0 {
+		return nil, errors.New("user must have a role")
 	}
 
 	return &User{
 		Username: username,
 		Password: pwd,
-		Role:     role,
+		Roles:    uniqueRoles(roles),
 		Deposit:  0,
 	}, nil
 
 }
 
-func (u *User) AddDeposit(coins Coins) error {
-	ok := u.HasRole("buyer")
+// SetPassword replace user password with hashed version of the given plaintext password.
+func (u *User) SetPassword(password string) error {
+	pwd, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	u.Password = pwd
+
+	return nil
+}
+
+// SetRoles replace the roles of the user.
+func (u *User) SetRoles(roles []string) error {
+	if len(roles) == 0 {
+		return errors.New("user must have a role")
+	}
+
+	u.Roles = uniqueRoles(roles)
+
+	return nil
+}
+
+// HasBalance report whether the user holds a deposit or earnings in any currency.
+func (u *User) HasBalance() bool {
+	if u.Deposit != 0 {
+		return true
+	}
 
-	if !ok {
-		return errors.New("User does not have buyer role")
+	for _, balance := range u.Earnings {
+		if balance != 0 {
+			return true
+		}
 	}
 
+	return false
+}
+
+// AddDeposit add coins and banknotes of the currency to the user deposit.
+func (u *User) AddDeposit(currency *Currency, coins Coins) error {
 	for _, coin := range coins {
-		if _, ok := acceptedCoinsMap[coin]; !ok {
-			return errors.New("Coin not accepted")
+		if !currency.Accepts(coin) {
+			return ErrCoinNotAccepted
 		}
 
 		u.Deposit += coin
@@ -65,8 +147,24 @@ func (u *User) AddDeposit(coins Coins) error {
 	return nil
 }
 
+// Sum returns total amount of the coins.
+func (c Coins) Sum() int {
+	total := 0
+	for _, coin := range c {
+		total += coin
+	}
+
+	return total
+}
+
 func (u *User) HasRole(roleName string) bool {
-	return u.Role == roleName
+	for _, role := range u.Roles {
+		if role == roleName {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (u *User) Authenticate(password string) bool {
@@ -74,6 +172,29 @@ func (u *User) Authenticate(password string) bool {
 	return err == nil
 }
 
+// dummyPassword is the bcrypt hash of a password no user has, at the default cost.
+const dummyPassword = "$2a$10$Dkir5KNpY5jUo7tDRSBRb.BU1DrYMJC6IDGWajIW3I7MyxKwKhRBu"
+
+// RejectPassword compare password against a hash no user has, logins of unknown usernames
+// then take as long to fail as wrong passwords and do not tell which usernames exist.
+func RejectPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword([]byte(dummyPassword), []byte(password))
+}
+
+// uniqueRoles returns roles without duplicates keeping their order.
+func uniqueRoles(roles []string) []string {
+	unique := make([]string, 0, len(roles))
+	seen := map[string]bool{}
+	for _, role := range roles {
+		if !seen[role] {
+			seen[role] = true
+			unique = append(unique, role)
+		}
+	}
+
+	return unique
+}
+
 // hashPassword generates a hashed password from a plaintext string
 func hashPassword(password string) (string, error) {
 	pw, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -1,6 +1,10 @@
 package models
 
-import "testing"
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
 
 func TestPasswordAuthentication(t *testing.T) {
 	hashPwd, err := hashPassword("testing")
@@ -12,7 +16,6 @@ func TestPasswordAuthentication(t *testing.T) {
 		Username: "bcmmbaga",
 		Password: hashPwd,
 		Deposit:  0,
-		Role:     "",
 	}
 
 	authenticated := user.Authenticate("testing")
@@ -20,3 +23,15 @@ func TestPasswordAuthentication(t *testing.T) {
 		t.Errorf("failed to authenticate user: %s", err.Error())
 	}
 }
+
+func TestDummyPasswordCost(t *testing.T) {
+	// unknown usernames must pay the same bcrypt cost as real users.
+	cost, err := bcrypt.Cost([]byte(dummyPassword))
+	if err != nil {
+		t.Fatalf("invalid dummy password hash: %s", err.Error())
+	}
+
+	if cost != bcrypt.DefaultCost {
+		t.Errorf("dummy password hash cost is %d, want %d", cost, bcrypt.DefaultCost)
+	}
+}
@@ -0,0 +1,50 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogFile append notifications as JSON lines to a file instead of delivering them, it is
+// meant for local development.
+type LogFile struct {
+	mu   sync.Mutex
+	path string
+}
+
+// NewLogFile returns a notifier appending to the file at path, the file is created on
+// the first notification.
+func NewLogFile(path string) *LogFile {
+	return &LogFile{path: path}
+}
+
+type logEntry struct {
+	Time time.Time `json:"time"`
+	*Notification
+}
+
+func (l *LogFile) Notify(ctx context.Context, notification *Notification) error {
+	line, err := json.Marshal(&logEntry{Time: time.Now().UTC(), Notification: notification})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
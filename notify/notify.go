@@ -0,0 +1,42 @@
+// Package notify deliver messages to users out of band, e.g password reset tokens.
+package notify
+
+import (
+	"context"
+	"fmt"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+)
+
+// Notification is a message to a user, Data holds values the message was built from so
+// notifiers can render their own format.
+type Notification struct {
+	To      string            `json:"to"`
+	Subject string            `json:"subject"`
+	Body    string            `json:"body"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// Notifier deliver notifications to users.
+type Notifier interface {
+	Notify(ctx context.Context, notification *Notification) error
+}
+
+// New returns the notifier selected in config.
+func New(config *vendingmachine.Config) (Notifier, error) {
+	switch config.Notifier {
+	case "log":
+		return NewLogFile(config.NotifierLogFile), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier %q", config.Notifier)
+	}
+}
+
+type discard struct{}
+
+func (discard) Notify(ctx context.Context, notification *Notification) error {
+	return nil
+}
+
+// Discard is a Notifier dropping every notification, for commands that never notify.
+var Discard Notifier = discard{}
@@ -1,24 +1,134 @@
 package vendingmachine
 
-import "context"
+import (
+	"context"
+	"time"
 
+	"github.com/bcmmbaga/vending-machine/models"
+)
+
+// Account describe user account and session management.
 type Account interface {
-	NewUser(ctx context.Context, username string, password string, role string) (interface{}, error)
-	GetUser(ctx context.Context, username string) (interface{}, error)
-	UpdateUser(ctx context.Context, username string, metadata interface{}) (interface{}, error)
-	DeleteUser(ctx context.Context, username string) error
-	Sessions(ctx context.Context, username string) (interface{}, error)
+	NewUser(ctx context.Context, username string, password string, roles []string) (*models.User, error)
+	GetUser(ctx context.Context, username string) (*models.User, error)
+	UpdateUser(ctx context.Context, username string, update models.UserUpdate) (*models.User, error)
+	DeleteUser(ctx context.Context, username string) (*models.User, error)
+
+	Authenticate(ctx context.Context, username string, password string, otp string, ip string) (*models.User, error)
+	ChangePassword(ctx context.Context, username string, oldPassword string, newPassword string, sessionID string) error
+	ForgotPassword(ctx context.Context, username string) error
+	ResetPassword(ctx context.Context, token string, newPassword string) error
+	EnrolTOTP(ctx context.Context, username string) (*models.TOTPEnrolment, error)
+	ConfirmTOTP(ctx context.Context, username string, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, username string, code string) error
+	NewSession(ctx context.Context, username string, userAgent string, ip string) (*models.Session, string, error)
+	RefreshSession(ctx context.Context, refreshToken string) (*models.Session, string, error)
+	ValidateSession(ctx context.Context, username string, sessionID string) error
+	RevokeSession(ctx context.Context, username string, sessionID string) error
+	RevokeSessions(ctx context.Context, username string) error
+	Sessions(ctx context.Context, username string) ([]*models.Session, error)
+}
+
+// APIKeys describe scoped keys users give to scripts and machines calling the API without
+// a login session.
+type APIKeys interface {
+	CreateAPIKey(ctx context.Context, username string, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error)
+	APIKeys(ctx context.Context, username string) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, username string, id string) error
+
+	// AuthenticateAPIKey returns the active API key and its user, it records the key use.
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, *models.User, error)
 }
 
+// Idempotency describe replay of requests retried with the same Idempotency-Key.
+type Idempotency interface {
+	// BeginRequest returns the request the user made with key, a new pending request is
+	// saved unless the key was already used. Completed requests are returned for replay.
+	BeginRequest(ctx context.Context, username string, key string, requestHash string) (*models.IdempotentRequest, bool, error)
+	CompleteRequest(ctx context.Context, req *models.IdempotentRequest, status int, contentType string, body []byte) error
+
+	// AbortRequest forget the pending request so it can be retried.
+	AbortRequest(ctx context.Context, req *models.IdempotentRequest) error
+}
+
+// Stock describe management of products offered by sellers.
 type Stock interface {
-	NewProduct(ctx context.Context, productName string, amountAvailable int, cost float64) (interface{}, error)
-	GetProduct(ctx context.Context, id string) (interface{}, error)
-	UpdateProductt(ctx context.Context, id string, metadata interface{}) (interface{}, error)
-	DeleteProduct(ctx context.Context, id string) error
+	NewProduct(ctx context.Context, seller string, productName string, amountAvailable int, cost int) (*models.Product, error)
+	GetProduct(ctx context.Context, id string) (*models.Product, error)
+	UpdateProduct(ctx context.Context, seller string, id string, update models.ProductUpdate) (*models.Product, error)
+	DeleteProduct(ctx context.Context, seller string, id string) (*models.Product, error)
+	ListProducts(ctx context.Context, query models.ProductQuery, cursor string) (*models.ProductPage, error)
+}
+
+// Machines describe management of vending machines and of the slots holding their stock.
+type Machines interface {
+	NewMachine(ctx context.Context, name string, location string, currency string) (*models.Machine, error)
+	GetMachine(ctx context.Context, id string) (*models.Machine, error)
+	ListMachines(ctx context.Context) ([]*models.Machine, error)
+	UpdateMachine(ctx context.Context, id string, update models.MachineUpdate) (*models.Machine, error)
+	DeleteMachine(ctx context.Context, operator string, id string) (*models.Machine, error)
+	NewSlot(ctx context.Context, machineID string, code string, productID string, capacity int, count int) (*models.Slot, error)
+	Slots(ctx context.Context, machineID string) ([]*models.Slot, error)
+	GetSlot(ctx context.Context, machineID string, code string) (*models.Slot, error)
+	UpdateSlot(ctx context.Context, machineID string, code string, update models.SlotUpdate) (*models.Slot, error)
+	DeleteSlot(ctx context.Context, machineID string, code string) (*models.Slot, error)
+}
+
+// Cash describe tracking of the coins inside machines, operator is the username of the
+// operator handling the coins.
+type Cash interface {
+	MachineCash(ctx context.Context, machineID string) (*models.MachineCash, error)
+	CollectCash(ctx context.Context, operator string, machineID string, counted models.CoinInventory) (*models.CashMovement, error)
+	TopUpFloat(ctx context.Context, operator string, machineID string, coins models.CoinInventory) (*models.CashMovement, error)
+	CashMovements(ctx context.Context, machineID string) ([]*models.CashMovement, error)
+}
+
+// Vending describe money movements made by buyers.
+type Vending interface {
+	Deposit(ctx context.Context, username string, machineID string, coins models.Coins) (*models.User, error)
+	ResetDeposit(ctx context.Context, username string, machineID string) (*models.Refund, error)
+	Buy(ctx context.Context, username string, machineID string, slot string, quantity int) (*models.Order, error)
+	Checkout(ctx context.Context, username string, machineID string, items []models.CartItem) (*models.Checkout, error)
+	Orders(ctx context.Context, username string, cursor string, limit int) (*models.OrderPage, error)
+	Order(ctx context.Context, username string, id string) (*models.Order, error)
+	CheckoutReceipt(ctx context.Context, username string, id string) (*models.Checkout, error)
+}
+
+// Sales describe earnings of sellers and their withdrawal.
+type Sales interface {
+	Earnings(ctx context.Context, seller string) ([]*models.Earnings, error)
+	Payout(ctx context.Context, seller string, currency string, amount int) ([]*models.LedgerEntry, error)
+}
+
+// Ledger describe checks of balances against the double-entry ledger.
+type Ledger interface {
+	Reconcile(ctx context.Context) (*models.Reconciliation, error)
+}
+
+// Admin describe management of user accounts by admins, actor is the username of the
+// admin making the change and every change is recorded in the audit trail.
+type Admin interface {
+	CreateAdmin(ctx context.Context, actor string, username string, password string) (*models.User, error)
+	ListUsers(ctx context.Context, search string, cursor string, limit int) (*models.UserPage, error)
+	SuspendUser(ctx context.Context, actor string, username string, reason string) (*models.User, error)
+	ReactivateUser(ctx context.Context, actor string, username string) (*models.User, error)
+	ForceLogout(ctx context.Context, actor string, username string) error
+	SetRoles(ctx context.Context, actor string, username string, roles []string) (*models.User, error)
+	AdjustBalance(ctx context.Context, actor string, username string, amount int, reason string, note string) (*models.User, error)
+	UnlockUser(ctx context.Context, actor string, username string) error
+	AuditTrail(ctx context.Context, query models.AuditQuery, cursor string) (*models.AuditPage, error)
 }
 
 // Service describe domain service implementation of vending machine.
 type Service interface {
 	Account
+	APIKeys
+	Idempotency
 	Stock
+	Machines
+	Cash
+	Vending
+	Sales
+	Ledger
+	Admin
 }
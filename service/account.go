@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+// NewUser create a user with the normalized username, it returns ValidationError listing
+// every rejected field when the username, password or roles are not allowed. Users can only
+// give themselves the configured sign up roles.
+func (v *vending) NewUser(ctx context.Context, username string, password string, roles []string) (*models.User, error) {
+	username = models.NormalizeUsername(username)
+
+	validation := v.validateCredentials(username, password)
+	validation.Add("roles", v.checkRoles(roles, v.signUpRoles())...)
+
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	return v.createUser(ctx, username, password, roles)
+}
+
+// signUpRoles returns the roles users can give themselves.
+func (v *vending) signUpRoles() []string {
+	if len(v.config.SignUpRoles) == 0 {
+		return []string{"buyer", "seller"}
+	}
+
+	return v.config.SignUpRoles
+}
+
+// checkRoles returns problems with roles, every role must be one of allowed.
+func (v *vending) checkRoles(roles []string, allowed []string) []string {
+	if len(roles) == 0 {
+		return []string{"is required"}
+	}
+
+	problems := []string{}
+	for _, role := range roles {
+		ok := false
+		for _, a := range allowed {
+			ok = ok || a == role
+		}
+
+		if !ok || !v.roles.Valid(role) {
+			problems = append(problems, fmt.Sprintf("role %q must be one of %s", role, strings.Join(allowed, ", ")))
+		}
+	}
+
+	return problems
+}
+
+// validateCredentials check a normalized username and a password against the policies.
+func (v *vending) validateCredentials(username string, password string) *vendingmachine.ValidationError {
+	validation := &vendingmachine.ValidationError{}
+	validation.Add("username", models.CheckUsername(username)...)
+	validation.Add("password", v.passwords.Check(password)...)
+
+	return validation
+}
+
+func (v *vending) createUser(ctx context.Context, username string, password string, roles []string) (*models.User, error) {
+	_, err := v.store.GetUser(ctx, username)
+	if err != storage.ErrNotFound {
+		if err != nil {
+			return nil, err
+		}
+		return nil, vendingmachine.ErrUserExists
+	}
+
+	user, err := models.NewUser(username, password, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	err = v.store.CreateUser(ctx, user)
+	if err != nil {
+		if err == storage.ErrDuplicate {
+			return nil, vendingmachine.ErrUserExists
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (v *vending) GetUser(ctx context.Context, username string) (*models.User, error) {
+	user, err := v.store.GetUser(ctx, username)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
+func (v *vending) UpdateUser(ctx context.Context, username string, update models.UserUpdate) (*models.User, error) {
+	user, err := v.GetUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Password != "" {
+		if err := user.SetPassword(update.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(update.Roles) != 0 {
+		if err := user.SetRoles(update.Roles); err != nil {
+			return nil, err
+		}
+	}
+
+	err = v.store.UpdateUser(ctx, user)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrUserNotFound)
+	}
+
+	return user, nil
+}
+
+// DeleteUser remove the account and revoke its sessions and API keys, accounts holding a
+// deposit or earnings are kept until the balance is withdrawn.
+func (v *vending) DeleteUser(ctx context.Context, username string) (*models.User, error) {
+	var user *models.User
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		stored, err := v.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		// the ledger accounts of the user must be settled first, deleting the user would
+		// otherwise leave their balance without an owner.
+		if stored.HasBalance() {
+			return vendingmachine.ErrBalanceNotEmpty
+		}
+
+		user, err = v.store.DeleteUser(ctx, username)
+		if err != nil {
+			return translate(err, vendingmachine.ErrUserNotFound)
+		}
+
+		err = v.store.RevokeSessions(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		return v.store.RevokeAPIKeys(ctx, username)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// Authenticate verify user credentials of a login made from the client ip, it returns
+// ErrInvalidCredentials for both unknown username and wrong password. Users with
+// two-factor authentication enabled also give a TOTP or recovery code as otp. Attempts
+// following repeated failures for the username or from the ip are rejected with
+// LoginLockedError without checking the credentials.
+func (v *vending) Authenticate(ctx context.Context, username string, password string, otp string, ip string) (*models.User, error) {
+	username = models.NormalizeUsername(username)
+
+	attempts := []string{models.UsernameAttempts(username), models.IPAttempts(ip)}
+
+	retryAfter, err := v.loginRetryAfter(ctx, attempts)
+	if err != nil {
+		return nil, err
+	}
+
+	if retryAfter > 0 {
+		return nil, &vendingmachine.LoginLockedError{RetryAfter: retryAfter}
+	}
+
+	user, err := v.GetUser(ctx, username)
+	if err != nil {
+		if err == vendingmachine.ErrUserNotFound {
+			models.RejectPassword(password)
+			return nil, v.failLogin(ctx, attempts)
+		}
+		return nil, err
+	}
+
+	if !user.Authenticate(password) {
+		return nil, v.failLogin(ctx, attempts)
+	}
+
+	if user.Suspended {
+		return nil, vendingmachine.ErrAccountSuspended
+	}
+
+	if user.TOTP.Enabled {
+		if otp == "" {
+			return nil, vendingmachine.ErrOTPRequired
+		}
+
+		err = v.verifySecondFactor(ctx, username, otp)
+		if err == vendingmachine.ErrInvalidOTP {
+			v.failLogin(ctx, attempts)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// failures from the ip are kept so a single client cannot reset its backoff by
+	// logging into an account it owns.
+	err = v.store.DeleteLoginAttempts(ctx, models.UsernameAttempts(username))
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// NewSession save new active session for the user and returns it with its refresh token,
+// every login gets its own session so a user can be logged in from several devices at once.
+func (v *vending) NewSession(ctx context.Context, username string, userAgent string, ip string) (*models.Session, string, error) {
+	session, refreshToken := models.NewSession(username, userAgent, ip, v.config.RefreshTokenTTL)
+
+	err := v.store.CreateSession(ctx, session)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// RefreshSession exchange the current refresh token of a session for a new one. Presenting
+// a refresh token that was already exchanged means it leaked, the whole session is revoked
+// so neither the thief nor the owner can keep using it.
+func (v *vending) RefreshSession(ctx context.Context, refreshToken string) (*models.Session, string, error) {
+	id, ok := models.RefreshTokenSession(refreshToken)
+	if !ok {
+		return nil, "", vendingmachine.ErrInvalidRefreshToken
+	}
+
+	session, err := v.store.GetSession(ctx, id)
+	if err != nil {
+		return nil, "", translate(err, vendingmachine.ErrInvalidRefreshToken)
+	}
+
+	if session.Status != models.SessionActive {
+		return nil, "", vendingmachine.ErrInvalidRefreshToken
+	}
+
+	if !session.MatchRefreshToken(refreshToken) {
+		if session.UsedRefreshToken(refreshToken) {
+			return nil, "", v.revokeReusedSession(ctx, session)
+		}
+
+		return nil, "", vendingmachine.ErrInvalidRefreshToken
+	}
+
+	if session.Expired() {
+		return nil, "", vendingmachine.ErrInvalidRefreshToken
+	}
+
+	previous := session.RefreshToken
+	rotated := session.RotateRefreshToken(v.config.RefreshTokenTTL)
+
+	err = v.store.RotateRefreshToken(ctx, session, previous)
+	if err != nil {
+		// another request rotated the same token first, one of them is not the owner.
+		if err == storage.ErrConflict {
+			return nil, "", v.revokeReusedSession(ctx, session)
+		}
+
+		return nil, "", err
+	}
+
+	return session, rotated, nil
+}
+
+// ValidateSession check that the session belongs to the user and is still active.
+func (v *vending) ValidateSession(ctx context.Context, username string, sessionID string) error {
+	_, err := v.activeSession(ctx, username, sessionID)
+	return err
+}
+
+// RevokeSession logout a single session of the user.
+func (v *vending) RevokeSession(ctx context.Context, username string, sessionID string) error {
+	_, err := v.activeSession(ctx, username, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return translate(v.store.RevokeSession(ctx, sessionID), vendingmachine.ErrInvalidSession)
+}
+
+// RevokeSessions logout every session of the user.
+func (v *vending) RevokeSessions(ctx context.Context, username string) error {
+	return v.store.RevokeSessions(ctx, username)
+}
+
+// Sessions returns active sessions of the user, oldest first.
+func (v *vending) Sessions(ctx context.Context, username string) ([]*models.Session, error) {
+	return v.store.ActiveSessions(ctx, username)
+}
+
+func (v *vending) revokeReusedSession(ctx context.Context, session *models.Session) error {
+	err := v.store.RevokeSession(ctx, session.ID)
+	if err != nil {
+		return err
+	}
+
+	return vendingmachine.ErrRefreshTokenReused
+}
+
+func (v *vending) activeSession(ctx context.Context, username string, sessionID string) (*models.Session, error) {
+	session, err := v.store.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrInvalidSession)
+	}
+
+	if session.Username != username || session.Status != models.SessionActive {
+		return nil, vendingmachine.ErrInvalidSession
+	}
+
+	return session, nil
+}
@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+const (
+	defaultUsersLimit = 20
+	maxUsersLimit     = 100
+
+	defaultAuditLimit = 50
+	maxAuditLimit     = 200
+)
+
+// CreateAdmin create an admin account, admins cannot sign up so they are created from
+// config or the command line.
+func (v *vending) CreateAdmin(ctx context.Context, actor string, username string, password string) (*models.User, error) {
+	username = models.NormalizeUsername(username)
+
+	if err := v.validateCredentials(username, password).Err(); err != nil {
+		return nil, err
+	}
+
+	if !v.roles.Valid("admin") {
+		return nil, errors.New("admin role is not configured")
+	}
+
+	var user *models.User
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = v.createUser(ctx, username, password, []string{"admin"})
+		if err != nil {
+			return err
+		}
+
+		return v.audit(ctx, models.NewAuditEntry(actor, models.AuditAdminCreate, username))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ListUsers returns a page of users whose username contains search, ordered by username.
+// The cursor of the next page is the last username of the page.
+func (v *vending) ListUsers(ctx context.Context, search string, cursor string, limit int) (*models.UserPage, error) {
+	if limit <= 0 {
+		limit = defaultUsersLimit
+	}
+
+	if limit > maxUsersLimit {
+		limit = maxUsersLimit
+	}
+
+	// fetch one more user than requested to know whether there is a next page.
+	users, err := v.store.ListUsers(ctx, &models.UserQuery{Search: search, After: cursor, Limit: limit + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.UserPage{Users: users}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		page.NextCursor = page.Users[limit-1].Username
+	}
+
+	return page, nil
+}
+
+// SuspendUser prevent the user from logging in and revoke every session of the user.
+func (v *vending) SuspendUser(ctx context.Context, actor string, username string, reason string) (*models.User, error) {
+	if actor == username {
+		return nil, vendingmachine.ErrSelfAdministration
+	}
+
+	return v.administer(ctx, actor, models.AuditUserSuspend, username, reason, func(ctx context.Context, user *models.User, entry *models.AuditEntry) error {
+		user.Suspended = true
+
+		err := v.store.UpdateUser(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return v.store.RevokeSessions(ctx, username)
+	})
+}
+
+// ReactivateUser let a suspended user login again.
+func (v *vending) ReactivateUser(ctx context.Context, actor string, username string) (*models.User, error) {
+	return v.administer(ctx, actor, models.AuditUserReactivate, username, "", func(ctx context.Context, user *models.User, entry *models.AuditEntry) error {
+		user.Suspended = false
+
+		return v.store.UpdateUser(ctx, user)
+	})
+}
+
+// ForceLogout revoke every session of the user.
+func (v *vending) ForceLogout(ctx context.Context, actor string, username string) error {
+	_, err := v.administer(ctx, actor, models.AuditUserLogout, username, "", func(ctx context.Context, user *models.User, entry *models.AuditEntry) error {
+		return v.store.RevokeSessions(ctx, username)
+	})
+
+	return err
+}
+
+// SetRoles replace the roles of the user with any of the configured roles, the previous
+// ones are kept in the audit trail. When the roles change every session of the user is
+// revoked so access and refresh tokens carrying the previous permissions stop working.
+func (v *vending) SetRoles(ctx context.Context, actor string, username string, roles []string) (*models.User, error) {
+	if actor == username {
+		return nil, vendingmachine.ErrSelfAdministration
+	}
+
+	configured := make([]string, 0, len(v.roles))
+	for role := range v.roles {
+		configured = append(configured, role)
+	}
+	sort.Strings(configured)
+
+	validation := &vendingmachine.ValidationError{}
+	validation.Add("roles", v.checkRoles(roles, configured)...)
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	return v.administer(ctx, actor, models.AuditUserRoles, username, "", func(ctx context.Context, user *models.User, entry *models.AuditEntry) error {
+		from := strings.Join(user.Roles, ",")
+
+		err := user.SetRoles(roles)
+		if err != nil {
+			return err
+		}
+
+		to := strings.Join(user.Roles, ",")
+		entry.Details = map[string]string{"from": from, "to": to}
+
+		err = v.store.UpdateUser(ctx, user)
+		if err != nil || from == to {
+			return err
+		}
+
+		return v.store.RevokeSessions(ctx, username)
+	})
+}
+
+// AdjustBalance credits the user with amount, or debits it when amount is negative, as a
+// manual correction recorded in the ledger with its reason code. The amount is in the
+// currency of the deposit, or in the default currency when the user has no deposit.
+func (v *vending) AdjustBalance(ctx context.Context, actor string, username string, amount int, reason string, note string) (*models.User, error) {
+	validation := &vendingmachine.ValidationError{}
+	if amount == 0 {
+		validation.Add("amount", "must not be zero")
+	}
+	if !models.ValidAdjustmentReason(reason) {
+		validation.Add("reason", "must be one of correction, goodwill, refund or chargeback")
+	}
+
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	var adjusted *models.User
+	_, err := v.administer(ctx, actor, models.AuditUserBalance, username, reason, func(ctx context.Context, user *models.User, entry *models.AuditEntry) error {
+		entry.Details = map[string]string{"amount": strconv.Itoa(amount)}
+		if note != "" {
+			entry.Details["note"] = note
+		}
+
+		// the deposit is adjusted in its currency, a user without deposit is credited in the
+		// default currency at whichever machine takes it.
+		machineID, currency := user.DepositMachine, v.ledgerCurrency(user.DepositCurrency)
+		if user.Deposit == 0 {
+			machineID, currency = "", v.defaultCurrency()
+		}
+		entry.Details["currency"] = currency
+
+		_, err := v.store.BindDeposit(ctx, username, machineID, currency)
+		if err != nil {
+			return translate(err, vendingmachine.ErrUserNotFound)
+		}
+
+		adjusted, err = v.store.IncrementDeposit(ctx, username, amount)
+		if err != nil {
+			if err == storage.ErrConflict {
+				return vendingmachine.ErrInsufficientDeposit
+			}
+			return translate(err, vendingmachine.ErrUserNotFound)
+		}
+
+		return v.record(ctx, models.NewAdjustmentTransaction(username, currency, amount, reason))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return adjusted, nil
+}
+
+// UnlockUser forget failed logins of the user so it can login again right away.
+func (v *vending) UnlockUser(ctx context.Context, actor string, username string) error {
+	_, err := v.administer(ctx, actor, models.AuditUserUnlock, username, "", func(ctx context.Context, user *models.User, entry *models.AuditEntry) error {
+		return v.store.DeleteLoginAttempts(ctx, models.UsernameAttempts(username))
+	})
+
+	return err
+}
+
+// AuditTrail returns a page of audit entries matching the query, newest first. The cursor
+// of the next page is the ID of the last entry of the page.
+func (v *vending) AuditTrail(ctx context.Context, query models.AuditQuery, cursor string) (*models.AuditPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultAuditLimit
+	}
+
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	// fetch one more entry than requested to know whether there is a next page.
+	query.Limit = limit + 1
+
+	if cursor != "" {
+		before, err := v.store.GetAuditEntry(ctx, cursor)
+		if err != nil {
+			return nil, translate(err, vendingmachine.ErrInvalidCursor)
+		}
+
+		query.Before = before
+	}
+
+	entries, err := v.store.ListAuditEntries(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.AuditPage{Entries: entries}
+	if len(entries) > limit {
+		page.Entries = entries[:limit]
+		page.NextCursor = page.Entries[limit-1].ID
+	}
+
+	return page, nil
+}
+
+// administer apply an admin action to the user and record it in the audit trail within a
+// single transaction, fn may add details to the audit entry.
+func (v *vending) administer(ctx context.Context, actor string, action string, username string, reason string,
+	fn func(ctx context.Context, user *models.User, entry *models.AuditEntry) error) (*models.User, error) {
+	var user *models.User
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = v.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		entry := models.NewAuditEntry(actor, action, username)
+		entry.Reason = reason
+
+		err = fn(ctx, user, entry)
+		if err != nil {
+			return err
+		}
+
+		return v.audit(ctx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (v *vending) audit(ctx context.Context, entry *models.AuditEntry) error {
+	return v.store.AppendAuditEntry(ctx, entry)
+}
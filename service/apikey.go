@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+// apiKeyTouchInterval limits how often the last use of a key is written.
+const apiKeyTouchInterval = time.Minute
+
+// CreateAPIKey returns a new API key of the user with the key itself, the key is only
+// returned once. Scopes must be permissions granted by the user roles.
+func (v *vending) CreateAPIKey(ctx context.Context, username string, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	user, err := v.GetUser(ctx, username)
+	if err != nil {
+		return nil, "", err
+	}
+
+	validation := &vendingmachine.ValidationError{}
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		validation.Add("name", "must be between 1 and 64 characters")
+	}
+
+	if len(scopes) == 0 {
+		validation.Add("scopes", "is required")
+	}
+
+	granted := v.roles.Permissions(user.Roles)
+	for _, scope := range scopes {
+		ok := false
+		for _, permission := range granted {
+			ok = ok || permission == scope
+		}
+
+		if !ok {
+			validation.Add("scopes", fmt.Sprintf("permission %q is not granted to the user", scope))
+		}
+	}
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		validation.Add("expiresAt", "must be in the future")
+	}
+
+	if err := validation.Err(); err != nil {
+		return nil, "", err
+	}
+
+	apiKey, key := models.NewAPIKey(username, name, scopes, expiresAt)
+
+	err = v.store.CreateAPIKey(ctx, apiKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// APIKeys returns every API key of the user, oldest first.
+func (v *vending) APIKeys(ctx context.Context, username string) ([]*models.APIKey, error) {
+	return v.store.ListAPIKeys(ctx, username)
+}
+
+// RevokeAPIKey stop accepting the API key of the user.
+func (v *vending) RevokeAPIKey(ctx context.Context, username string, id string) error {
+	err := v.store.RevokeAPIKey(ctx, username, id)
+	if err != nil {
+		return translate(err, vendingmachine.ErrAPIKeyNotFound)
+	}
+
+	return nil
+}
+
+// AuthenticateAPIKey returns the API key and its user, it returns ErrInvalidAPIKey for
+// unknown, revoked and expired keys and ErrAccountSuspended when the user is suspended.
+func (v *vending) AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, *models.User, error) {
+	if !models.IsAPIKey(key) {
+		return nil, nil, vendingmachine.ErrInvalidAPIKey
+	}
+
+	apiKey, err := v.store.FindAPIKey(ctx, models.APIKeyHash(key))
+	if err != nil {
+		return nil, nil, translate(err, vendingmachine.ErrInvalidAPIKey)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	if !apiKey.Active(now) {
+		return nil, nil, vendingmachine.ErrInvalidAPIKey
+	}
+
+	user, err := v.store.GetUser(ctx, apiKey.Username)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return nil, nil, vendingmachine.ErrInvalidAPIKey
+		}
+		return nil, nil, err
+	}
+
+	if user.Suspended {
+		return nil, nil, vendingmachine.ErrAccountSuspended
+	}
+
+	// keys used by machines are busy, only record their use once in a while.
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		err = v.store.TouchAPIKey(ctx, apiKey.ID, now)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		apiKey.LastUsedAt = &now
+	}
+
+	return apiKey, user, nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+)
+
+// defaultCassetteCapacity is used when the configured cassette capacity is not positive.
+const defaultCassetteCapacity = 50
+
+// MachineCash returns the coins held by the cassette and the cashbox of the machine.
+func (v *vending) MachineCash(ctx context.Context, machineID string) (*models.MachineCash, error) {
+	_, err := v.GetMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	cassette, err := v.store.GetCoins(ctx, models.CassetteID(machineID))
+	if err != nil {
+		return nil, err
+	}
+
+	cashbox, err := v.store.GetCoins(ctx, models.CashboxID(machineID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MachineCash{MachineID: machineID, Cassette: cassette, Cashbox: cashbox}, nil
+}
+
+// CollectCash empty the cashbox of the machine and record the coins counted by the operator
+// against the coins the cashbox held, the discrepancy of the collection tells whether they
+// match.
+func (v *vending) CollectCash(ctx context.Context, operator string, machineID string, counted models.CoinInventory) (*models.CashMovement, error) {
+	currency, err := v.machineCurrency(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cashbox holds banknotes too and may have been found empty.
+	err = checkMoney(currency, counted, true, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var collection *models.CashMovement
+
+	err = v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		expected, err := v.store.GetCoins(ctx, models.CashboxID(machineID))
+		if err != nil {
+			return err
+		}
+
+		_, err = v.store.IncrementCoins(ctx, models.CashboxID(machineID), expected.Negate())
+		if err != nil {
+			return err
+		}
+
+		collection = models.NewCashCollection(machineID, operator, counted, expected)
+		return v.store.CreateCashMovement(ctx, collection)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return collection, nil
+}
+
+// TopUpFloat add coins to the cassette of the machine, a top-up overfilling the cassette is
+// rejected with vendingmachine.ErrCassetteFull.
+func (v *vending) TopUpFloat(ctx context.Context, operator string, machineID string, coins models.CoinInventory) (*models.CashMovement, error) {
+	currency, err := v.machineCurrency(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkMoney(currency, coins, false, false)
+	if err != nil {
+		return nil, err
+	}
+
+	topUp := models.NewFloatTopUp(machineID, operator, coins)
+
+	err = v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		cassette, err := v.store.GetCoins(ctx, models.CassetteID(machineID))
+		if err != nil {
+			return err
+		}
+
+		_, overflow := cassette.Split(coins, v.cassetteCapacity())
+		if overflow.Total() > 0 {
+			return vendingmachine.ErrCassetteFull
+		}
+
+		_, err = v.store.IncrementCoins(ctx, models.CassetteID(machineID), coins)
+		if err != nil {
+			return err
+		}
+
+		return v.store.CreateCashMovement(ctx, topUp)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return topUp, nil
+}
+
+// CashMovements returns the collections and top-ups of the machine newest first.
+func (v *vending) CashMovements(ctx context.Context, machineID string) ([]*models.CashMovement, error) {
+	_, err := v.GetMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.store.ListCashMovements(ctx, machineID)
+}
+
+// insertCoins add money inserted by a buyer to the machine, the cassette is refilled first
+// and the coins it has no room for drop into the cashbox with the banknotes.
+func (v *vending) insertCoins(ctx context.Context, machineID string, currency *models.Currency, money models.CoinInventory) error {
+	cassette, err := v.store.GetCoins(ctx, models.CassetteID(machineID))
+	if err != nil {
+		return err
+	}
+
+	coins, banknotes := currency.SplitBanknotes(money)
+	kept, overflow := cassette.Split(coins, v.cassetteCapacity())
+	for note, count := range banknotes {
+		overflow[note] += count
+	}
+
+	_, err = v.store.IncrementCoins(ctx, models.CassetteID(machineID), kept)
+	if err != nil {
+		return err
+	}
+
+	_, err = v.store.IncrementCoins(ctx, models.CashboxID(machineID), overflow)
+	return err
+}
+
+func (v *vending) cassetteCapacity() int {
+	if v.config.CassetteCapacity <= 0 {
+		return defaultCassetteCapacity
+	}
+
+	return v.config.CassetteCapacity
+}
+
+// checkMoney reject counts of denominations the currency does not accept, of banknotes unless
+// banknotes is set, or below zero, and empty counts unless allowEmpty.
+func checkMoney(currency *models.Currency, money models.CoinInventory, banknotes bool, allowEmpty bool) error {
+	validation := &vendingmachine.ValidationError{}
+
+	if err := currency.Check(money, banknotes); err != nil {
+		validation.Add("coins", err.Error())
+	} else if money.Total() == 0 && !allowEmpty {
+		validation.Add("coins", "must hold at least one coin")
+	}
+
+	return validation.Err()
+}
+
+// machineCurrency returns the currency accepted by the machine with the given ID.
+func (v *vending) machineCurrency(ctx context.Context, machineID string) (*models.Currency, error) {
+	machine, err := v.GetMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.currency(machine)
+}
+
+// currency returns the currency accepted by the machine.
+func (v *vending) currency(machine *models.Machine) (*models.Currency, error) {
+	currency := v.currencies[machine.Currency]
+	if currency == nil {
+		return nil, vendingmachine.ErrUnknownCurrency
+	}
+
+	return currency, nil
+}
+
+func (v *vending) defaultCurrency() string {
+	if v.config.Currency == "" {
+		return models.DefaultCurrencyCode
+	}
+
+	return v.config.Currency
+}
+
+// currencyCodes returns the sorted codes of the configured currencies.
+func (v *vending) currencyCodes() []string {
+	codes := []string{}
+	for code := range v.currencies {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	return codes
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+const (
+	defaultIdempotencyTTL   = 24 * time.Hour
+	defaultIdempotencyLease = 30 * time.Second
+)
+
+// BeginRequest save a pending request made by the user with key. When the key was already
+// used the stored request is returned instead, replay is true once it is completed. It
+// returns ErrIdempotencyKeyReuse when the key was used with another request and
+// ErrRequestInProgress while the first request is pending. A pending request whose lease
+// expired, because the attempt running it crashed, is taken over by the retry.
+func (v *vending) BeginRequest(ctx context.Context, username string, key string, requestHash string) (*models.IdempotentRequest, bool, error) {
+	ttl := v.config.IdempotencyTTL
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+
+	lease := v.config.IdempotencyLease
+	if lease <= 0 {
+		lease = defaultIdempotencyLease
+	}
+
+	req := models.NewIdempotentRequest(username, key, requestHash, ttl, lease)
+
+	err := v.store.CreateIdempotentRequest(ctx, req)
+	if err != storage.ErrDuplicate {
+		return req, false, err
+	}
+
+	stored, err := v.store.GetIdempotentRequest(ctx, req.ID)
+	if err != nil {
+		// the request was forgotten since, a concurrent retry is about to run it again.
+		return nil, false, translate(err, vendingmachine.ErrRequestInProgress)
+	}
+
+	now := time.Now()
+
+	// expired requests may outlive their TTL until the store purge them.
+	if stored.Expired(now) {
+		return v.takeOverRequest(ctx, req, stored)
+	}
+
+	if stored.RequestHash != requestHash {
+		return nil, false, vendingmachine.ErrIdempotencyKeyReuse
+	}
+
+	if stored.Completed {
+		return stored, true, nil
+	}
+
+	if stored.Leased(now) {
+		return nil, false, vendingmachine.ErrRequestInProgress
+	}
+
+	return v.takeOverRequest(ctx, req, stored)
+}
+
+// takeOverRequest replace the stored request with req, a concurrent retry taking it over
+// first wins and req is reported in progress.
+func (v *vending) takeOverRequest(ctx context.Context, req *models.IdempotentRequest, stored *models.IdempotentRequest) (*models.IdempotentRequest, bool, error) {
+	err := v.store.ReplaceIdempotentRequest(ctx, req, stored.Lease)
+	if err != nil {
+		if err == storage.ErrConflict {
+			return nil, false, vendingmachine.ErrRequestInProgress
+		}
+		return nil, false, err
+	}
+
+	return req, false, nil
+}
+
+// CompleteRequest save the response of the pending request for replay, it returns
+// ErrRequestInProgress when a retry took the request over since. Called within the
+// transaction applying the request, the response is saved only if the request is.
+func (v *vending) CompleteRequest(ctx context.Context, req *models.IdempotentRequest, status int, contentType string, body []byte) error {
+	req.Complete(status, contentType, body)
+
+	err := v.store.CompleteIdempotentRequest(ctx, req)
+	if err == storage.ErrConflict {
+		return vendingmachine.ErrRequestInProgress
+	}
+
+	return err
+}
+
+// AbortRequest forget the pending request, retries with the same key are applied again.
+func (v *vending) AbortRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	return v.store.DeleteIdempotentRequest(ctx, req)
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+)
+
+// reconcilePageSize is how many users are checked against the ledger at once.
+const reconcilePageSize = 100
+
+// record append a ledger transaction, unbalanced transactions are rejected so the ledger
+// always sums to zero.
+func (v *vending) record(ctx context.Context, entries []*models.LedgerEntry) error {
+	if !models.LedgerBalanced(entries) {
+		return vendingmachine.ErrUnbalancedLedger
+	}
+
+	return v.store.AppendLedgerEntries(ctx, entries...)
+}
+
+// Reconcile compare the stored deposit and earnings of every user with the balance of the
+// matching ledger account in each currency, balances that disagree are reported as
+// discrepancies.
+func (v *vending) Reconcile(ctx context.Context) (*models.Reconciliation, error) {
+	balances, err := v.ledgerBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliation := &models.Reconciliation{Discrepancies: []models.Discrepancy{}, Imbalances: map[string]int{}}
+
+	totals := map[string]int{}
+	for _, account := range balances {
+		for currency, balance := range account {
+			totals[currency] += balance
+		}
+	}
+
+	for currency, total := range totals {
+		if total != 0 {
+			reconciliation.Imbalances[currency] = total
+		}
+	}
+
+	query := &models.UserQuery{Limit: reconcilePageSize}
+	for {
+		users, err := v.store.ListUsers(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, user := range users {
+			deposit := map[string]int{}
+			if user.Deposit != 0 {
+				deposit[v.ledgerCurrency(user.DepositCurrency)] = user.Deposit
+			}
+
+			accounts := []struct {
+				name     string
+				balances map[string]int
+			}{
+				{user.Username, deposit},
+				{models.EarningsAccount(user.Username), user.Earnings},
+			}
+
+			for _, account := range accounts {
+				ledger := balances[account.name]
+				for _, currency := range balanceCurrencies(account.balances, ledger) {
+					if ledger[currency] != account.balances[currency] {
+						reconciliation.Discrepancies = append(reconciliation.Discrepancies, models.Discrepancy{
+							Username: user.Username,
+							Account:  account.name,
+							Currency: currency,
+							Balance:  account.balances[currency],
+							Ledger:   ledger[currency],
+						})
+					}
+				}
+			}
+		}
+
+		if len(users) < reconcilePageSize {
+			break
+		}
+
+		query.After = users[len(users)-1].Username
+	}
+
+	return reconciliation, nil
+}
+
+// ledgerCurrency returns the currency of amounts recorded without one, before every machine
+// had its own currency, which is the default currency.
+func (v *vending) ledgerCurrency(currency string) string {
+	if currency == "" {
+		return v.defaultCurrency()
+	}
+
+	return currency
+}
+
+// ledgerEntries returns every entry of the account, oldest first, with their currency set.
+func (v *vending) ledgerEntries(ctx context.Context, account string) ([]*models.LedgerEntry, error) {
+	entries, err := v.store.LedgerEntries(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		entry.Currency = v.ledgerCurrency(entry.Currency)
+	}
+
+	return entries, nil
+}
+
+// ledgerBalances returns the balances of every account in each currency.
+func (v *vending) ledgerBalances(ctx context.Context) (models.LedgerBalances, error) {
+	stored, err := v.store.LedgerBalances(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := models.LedgerBalances{}
+	for account, currencies := range stored {
+		for currency, balance := range currencies {
+			balances.Add(account, v.ledgerCurrency(currency), balance)
+		}
+	}
+
+	return balances, nil
+}
+
+// balanceCurrencies returns the sorted currency codes of every balance.
+func balanceCurrencies(balances ...map[string]int) []string {
+	seen := map[string]bool{}
+	codes := []string{}
+	for _, balance := range balances {
+		for code := range balance {
+			if !seen[code] {
+				seen[code] = true
+				codes = append(codes, code)
+			}
+		}
+	}
+	sort.Strings(codes)
+
+	return codes
+}
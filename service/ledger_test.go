@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemory()
+	s := New(store, notify.Discard, &vendingmachine.Config{VendMode: vendingmachine.VendModeSession})
+
+	_, err := s.NewUser(ctx, "buyer1", "vending-pass1", []string{"buyer"})
+	assert.NoError(t, err)
+
+	_, err = s.NewUser(ctx, "seller1", "vending-pass1", []string{"seller"})
+	assert.NoError(t, err)
+
+	product, err := s.NewProduct(ctx, "seller1", "testing", 10, 15)
+	assert.NoError(t, err)
+
+	machine, err := s.NewMachine(ctx, "lobby", "", "")
+	assert.NoError(t, err)
+
+	_, err = s.NewSlot(ctx, machine.ID, "A1", product.ID, 10, 10)
+	assert.NoError(t, err)
+
+	_, err = s.Deposit(ctx, "buyer1", machine.ID, models.Coins{20, 20, 10, 5})
+	assert.NoError(t, err)
+
+	order, err := s.Buy(ctx, "buyer1", machine.ID, "A1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 25, order.Change.Total())
+
+	_, err = s.Deposit(ctx, "buyer1", machine.ID, models.Coins{50})
+	assert.NoError(t, err)
+
+	_, err = s.ResetDeposit(ctx, "buyer1", machine.ID)
+	assert.NoError(t, err)
+
+	_, err = s.Payout(ctx, "seller1", "EUR", 10)
+	assert.NoError(t, err)
+
+	result, err := s.Reconcile(ctx)
+	assert.NoError(t, err)
+	assert.True(t, result.OK())
+
+	balances, err := store.LedgerBalances(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, balances["buyer1"]["EUR"])
+	assert.Equal(t, 0, balances["seller1"]["EUR"])
+	assert.Equal(t, 20, balances[models.EarningsAccount("seller1")]["EUR"])
+	assert.Equal(t, 10, balances[models.PayoutsAccount]["EUR"])
+
+	seller, err := store.GetUser(ctx, "seller1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, seller.Deposit)
+	assert.Equal(t, map[string]int{"EUR": 20}, seller.Earnings)
+
+	// a balance changed outside of the ledger is flagged.
+	_, err = store.IncrementEarnings(ctx, "seller1", "EUR", 5)
+	assert.NoError(t, err)
+
+	result, err = s.Reconcile(ctx)
+	assert.NoError(t, err)
+	assert.False(t, result.OK())
+	assert.Equal(t, []models.Discrepancy{
+		{Username: "seller1", Account: models.EarningsAccount("seller1"), Currency: "EUR", Balance: 25, Ledger: 20},
+	}, result.Discrepancies)
+}
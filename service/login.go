@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+func (v *vending) loginPolicy() models.LoginPolicy {
+	return models.LoginPolicy{
+		MaxFailures: v.config.LoginMaxFailures,
+		BaseDelay:   v.config.LoginBackoff,
+		MaxDelay:    v.config.LoginMaxBackoff,
+		Lockout:     v.config.LoginLockout,
+	}
+}
+
+// loginRetryAfter returns the longest wait imposed by the given login attempts.
+func (v *vending) loginRetryAfter(ctx context.Context, ids []string) (time.Duration, error) {
+	if v.config.LoginMaxFailures <= 0 {
+		return 0, nil
+	}
+
+	now := time.Now().UTC()
+
+	var retryAfter time.Duration
+	for _, id := range ids {
+		attempts, err := v.store.GetLoginAttempts(ctx, id)
+		if err != nil {
+			if err == storage.ErrNotFound {
+				continue
+			}
+			return 0, err
+		}
+
+		if wait := attempts.RetryAfter(now); wait > retryAfter {
+			retryAfter = wait
+		}
+	}
+
+	return retryAfter, nil
+}
+
+// failLogin record a failed login against every given login attempts, it returns
+// ErrInvalidCredentials once recorded.
+func (v *vending) failLogin(ctx context.Context, ids []string) error {
+	if v.config.LoginMaxFailures <= 0 {
+		return vendingmachine.ErrInvalidCredentials
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		for _, id := range ids {
+			attempts, err := v.store.GetLoginAttempts(ctx, id)
+			if err != nil {
+				if err != storage.ErrNotFound {
+					return err
+				}
+				attempts = &models.LoginAttempts{ID: id}
+			}
+
+			attempts.Fail(now, v.loginPolicy())
+
+			err = v.store.SaveLoginAttempts(ctx, attempts)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return vendingmachine.ErrInvalidCredentials
+}
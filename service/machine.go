@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+// NewMachine add a machine accepting the currency with the given code, the configured
+// currency is used when it is empty.
+func (v *vending) NewMachine(ctx context.Context, name string, location string, currency string) (*models.Machine, error) {
+	name = strings.TrimSpace(name)
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		currency = v.defaultCurrency()
+	}
+
+	validation := &vendingmachine.ValidationError{}
+	if name == "" {
+		validation.Add("name", "is required")
+	}
+
+	if v.currencies[currency] == nil {
+		validation.Add("currency", "must be one of "+strings.Join(v.currencyCodes(), ", "))
+	}
+
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	machine := models.NewMachine(name, strings.TrimSpace(location), currency)
+
+	err := v.store.CreateMachine(ctx, machine)
+	if err != nil {
+		return nil, err
+	}
+
+	return machine, nil
+}
+
+func (v *vending) GetMachine(ctx context.Context, id string) (*models.Machine, error) {
+	machine, err := v.store.GetMachine(ctx, id)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrMachineNotFound)
+	}
+
+	v.setDefaultCurrency(machine)
+
+	return machine, nil
+}
+
+func (v *vending) ListMachines(ctx context.Context) ([]*models.Machine, error) {
+	machines, err := v.store.ListMachines(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, machine := range machines {
+		v.setDefaultCurrency(machine)
+	}
+
+	return machines, nil
+}
+
+// setDefaultCurrency set the configured currency on machines created before currencies were
+// configurable.
+func (v *vending) setDefaultCurrency(machine *models.Machine) {
+	if machine.Currency == "" {
+		machine.Currency = v.defaultCurrency()
+	}
+}
+
+// UpdateMachine update machine fields with non zero values of update.
+func (v *vending) UpdateMachine(ctx context.Context, id string, update models.MachineUpdate) (*models.Machine, error) {
+	if update.Status != "" && !models.ValidMachineStatus(update.Status) {
+		validation := &vendingmachine.ValidationError{}
+		validation.Add("status", "must be one of "+strings.Join([]string{models.MachineActive, models.MachineMaintenance, models.MachineRetired}, ", "))
+		return nil, validation
+	}
+
+	machine, err := v.GetMachine(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if name := strings.TrimSpace(update.Name); name != "" {
+		machine.Name = name
+	}
+
+	if location := strings.TrimSpace(update.Location); location != "" {
+		machine.Location = location
+	}
+
+	if update.Status != "" {
+		machine.Status = update.Status
+	}
+
+	err = v.store.UpdateMachine(ctx, machine)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrMachineNotFound)
+	}
+
+	return machine, nil
+}
+
+// DeleteMachine remove a machine, slots must be deleted first so the units they hold are
+// returned to the stock of their products. The cashbox must be collected and the deposits the
+// machine holds refunded first too, the coins left in the cassette are then unloaded by the
+// operator as part of the deletion.
+func (v *vending) DeleteMachine(ctx context.Context, operator string, id string) (*models.Machine, error) {
+	var machine *models.Machine
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		slots, err := v.store.ListSlots(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if len(slots) > 0 {
+			return vendingmachine.ErrMachineNotEmpty
+		}
+
+		cashbox, err := v.store.GetCoins(ctx, models.CashboxID(id))
+		if err != nil {
+			return err
+		}
+
+		if cashbox.Total() > 0 {
+			return vendingmachine.ErrCashboxNotEmpty
+		}
+
+		holders, err := v.store.ListUsers(ctx, &models.UserQuery{DepositMachine: id, Limit: 1})
+		if err != nil {
+			return err
+		}
+
+		if len(holders) > 0 {
+			return vendingmachine.ErrMachineHoldsDeposit
+		}
+
+		machine, err = v.store.DeleteMachine(ctx, id)
+		if err != nil {
+			return translate(err, vendingmachine.ErrMachineNotFound)
+		}
+
+		cassette, err := v.store.GetCoins(ctx, models.CassetteID(id))
+		if err != nil || cassette.Total() == 0 {
+			return err
+		}
+
+		_, err = v.store.IncrementCoins(ctx, models.CassetteID(id), cassette.Negate())
+		if err != nil {
+			return err
+		}
+
+		return v.store.CreateCashMovement(ctx, models.NewFloatUnload(id, operator, cassette))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return machine, nil
+}
+
+// NewSlot add a slot to the machine, the units loaded into it are taken from the stock of
+// the product.
+func (v *vending) NewSlot(ctx context.Context, machineID string, code string, productID string, capacity int, count int) (*models.Slot, error) {
+	slot := models.NewSlot(machineID, models.NormalizeSlotCode(code), productID, capacity, count)
+
+	validation := &vendingmachine.ValidationError{}
+	if !models.ValidSlotCode(slot.Code) {
+		validation.Add("code", "must be a row letter followed by a column number, for example A3")
+	}
+	checkSlot(validation, slot)
+
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		machine, err := v.GetMachine(ctx, machineID)
+		if err != nil {
+			return err
+		}
+
+		err = v.checkPrice(ctx, machine, slot.ProductID)
+		if err != nil {
+			return err
+		}
+
+		err = v.store.CreateSlot(ctx, slot)
+		if err != nil {
+			if err == storage.ErrDuplicate {
+				return vendingmachine.ErrSlotExists
+			}
+			return err
+		}
+
+		return v.load(ctx, slot.ProductID, slot.Count)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slot, nil
+}
+
+// Slots returns the slots of the machine ordered by code.
+func (v *vending) Slots(ctx context.Context, machineID string) ([]*models.Slot, error) {
+	_, err := v.GetMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	return v.store.ListSlots(ctx, machineID)
+}
+
+func (v *vending) GetSlot(ctx context.Context, machineID string, code string) (*models.Slot, error) {
+	slot, err := v.store.GetSlot(ctx, machineID, models.NormalizeSlotCode(code))
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrSlotNotFound)
+	}
+
+	return slot, nil
+}
+
+// UpdateSlot update slot fields with the values of update. Changing the count loads or
+// unloads units from the stock of the product, changing the product returns the units of
+// the previous product to its stock.
+func (v *vending) UpdateSlot(ctx context.Context, machineID string, code string, update models.SlotUpdate) (*models.Slot, error) {
+	var slot *models.Slot
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		slot, err = v.GetSlot(ctx, machineID, code)
+		if err != nil {
+			return err
+		}
+
+		previous := *slot
+
+		if update.ProductID != "" {
+			slot.ProductID = update.ProductID
+		}
+
+		if update.Capacity != 0 {
+			slot.Capacity = update.Capacity
+		}
+
+		if update.Count != nil {
+			slot.Count = *update.Count
+		}
+
+		validation := &vendingmachine.ValidationError{}
+		checkSlot(validation, slot)
+
+		if err := validation.Err(); err != nil {
+			return err
+		}
+
+		if slot.ProductID != previous.ProductID {
+			machine, err := v.GetMachine(ctx, machineID)
+			if err != nil {
+				return err
+			}
+
+			err = v.checkPrice(ctx, machine, slot.ProductID)
+			if err != nil {
+				return err
+			}
+		}
+
+		if slot.ProductID == previous.ProductID {
+			err = v.load(ctx, slot.ProductID, slot.Count-previous.Count)
+		} else {
+			err = v.unload(ctx, &previous)
+			if err == nil {
+				err = v.load(ctx, slot.ProductID, slot.Count)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		err = v.store.UpdateSlot(ctx, slot)
+		return translate(err, vendingmachine.ErrSlotNotFound)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slot, nil
+}
+
+// DeleteSlot remove a slot of the machine, the units it holds are returned to the stock of
+// the product.
+func (v *vending) DeleteSlot(ctx context.Context, machineID string, code string) (*models.Slot, error) {
+	var slot *models.Slot
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		slot, err = v.store.DeleteSlot(ctx, machineID, models.NormalizeSlotCode(code))
+		if err != nil {
+			return translate(err, vendingmachine.ErrSlotNotFound)
+		}
+
+		return v.unload(ctx, slot)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return slot, nil
+}
+
+// checkSlot add the problems with the capacity, count and product of slot to validation.
+func checkSlot(validation *vendingmachine.ValidationError, slot *models.Slot) {
+	if slot.Capacity <= 0 {
+		validation.Add("capacity", "must be greater than zero")
+	}
+
+	if slot.Count < 0 || slot.Count > slot.Capacity {
+		validation.Add("count", "must be between zero and the slot capacity")
+	}
+
+	if slot.Count > 0 && slot.ProductID == "" {
+		validation.Add("productId", "is required to load the slot")
+	}
+}
+
+// checkPrice reject loading the product into the machine when its cost cannot be paid with
+// the denominations of the machine currency.
+func (v *vending) checkPrice(ctx context.Context, machine *models.Machine, productID string) error {
+	if productID == "" {
+		return nil
+	}
+
+	currency, err := v.currency(machine)
+	if err != nil {
+		return err
+	}
+
+	product, err := v.GetProduct(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	if product.Cost%currency.Unit() != 0 {
+		validation := &vendingmachine.ValidationError{}
+		validation.Add("productId", costProblem(currency, product.Cost))
+		return validation
+	}
+
+	return nil
+}
+
+func costProblem(currency *models.Currency, cost int) string {
+	return fmt.Sprintf("cost must be a multiple of %d to be paid in %s", currency.Unit(), currency.Code)
+}
+
+// load move quantity units of the product from its stock into a slot, a negative quantity
+// moves units back to the stock.
+func (v *vending) load(ctx context.Context, productID string, quantity int) error {
+	if productID == "" {
+		return nil
+	}
+
+	_, err := v.store.IncrementStock(ctx, productID, -quantity)
+	if err != nil {
+		if err == storage.ErrConflict {
+			return vendingmachine.ErrInsufficientStock
+		}
+		return translate(err, vendingmachine.ErrProductNotFound)
+	}
+
+	return nil
+}
+
+// unload return the units held by slot to the stock of its product, units of a deleted
+// product are dropped.
+func (v *vending) unload(ctx context.Context, slot *models.Slot) error {
+	err := v.load(ctx, slot.ProductID, -slot.Count)
+	if err == vendingmachine.ErrProductNotFound {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+// ChangePassword replace the user password once the old one is verified, every session
+// but the one making the change is revoked along with the change.
+func (v *vending) ChangePassword(ctx context.Context, username string, oldPassword string, newPassword string, sessionID string) error {
+	validation := &vendingmachine.ValidationError{}
+	validation.Add("newPassword", v.passwords.Check(newPassword)...)
+	if err := validation.Err(); err != nil {
+		return err
+	}
+
+	return v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := v.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		if !user.Authenticate(oldPassword) {
+			return vendingmachine.ErrInvalidCredentials
+		}
+
+		err = v.setPassword(ctx, user, newPassword)
+		if err != nil {
+			return err
+		}
+
+		sessions, err := v.store.ActiveSessions(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		for _, session := range sessions {
+			if session.ID == sessionID {
+				continue
+			}
+
+			err = v.store.RevokeSession(ctx, session.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ForgotPassword send a password reset token to the user. Unknown usernames are ignored
+// so the response does not reveal which accounts exist.
+func (v *vending) ForgotPassword(ctx context.Context, username string) error {
+	username = models.NormalizeUsername(username)
+
+	_, err := v.GetUser(ctx, username)
+	if err != nil {
+		if err == vendingmachine.ErrUserNotFound {
+			return nil
+		}
+		return err
+	}
+
+	reset, token := models.NewPasswordReset(username, v.config.PasswordResetTTL)
+
+	err = v.store.CreatePasswordReset(ctx, reset)
+	if err != nil {
+		return err
+	}
+
+	return v.notifier.Notify(ctx, &notify.Notification{
+		To:      username,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Use the token %s to set a new password before %s.",
+			token, reset.ExpiresAt.Format(time.RFC1123)),
+		Data: map[string]string{"token": token},
+	})
+}
+
+// ResetPassword set a new password with a token sent by ForgotPassword, the token is used
+// up and every session of the user is revoked in the same transaction.
+func (v *vending) ResetPassword(ctx context.Context, token string, newPassword string) error {
+	validation := &vendingmachine.ValidationError{}
+	validation.Add("newPassword", v.passwords.Check(newPassword)...)
+	if err := validation.Err(); err != nil {
+		return err
+	}
+
+	return v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		reset, err := v.store.UsePasswordReset(ctx, models.PasswordResetID(token), time.Now().UTC())
+		if err != nil {
+			if err == storage.ErrNotFound {
+				return vendingmachine.ErrInvalidResetToken
+			}
+			return err
+		}
+
+		user, err := v.GetUser(ctx, reset.Username)
+		if err != nil {
+			return err
+		}
+
+		err = v.setPassword(ctx, user, newPassword)
+		if err != nil {
+			return err
+		}
+
+		return v.store.RevokeSessions(ctx, reset.Username)
+	})
+}
+
+// setPassword save the hash of password as the user password, leaving the other fields of
+// the user to concurrent updates.
+func (v *vending) setPassword(ctx context.Context, user *models.User, password string) error {
+	if err := user.SetPassword(password); err != nil {
+		return err
+	}
+
+	return translate(v.store.UpdatePassword(ctx, user.Username, user.Password), vendingmachine.ErrUserNotFound)
+}
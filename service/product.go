@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+)
+
+// NewProduct create a product of the seller, it returns ValidationError when the cost is
+// not positive.
+func (v *vending) NewProduct(ctx context.Context, seller string, productName string, amountAvailable int, cost int) (*models.Product, error) {
+	if cost <= 0 {
+		validation := &vendingmachine.ValidationError{}
+		validation.Add("cost", "must be greater than zero")
+		return nil, validation
+	}
+
+	product := models.NewProduct(productName, amountAvailable, cost, seller)
+
+	err := v.store.CreateProduct(ctx, product)
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+func (v *vending) GetProduct(ctx context.Context, id string) (*models.Product, error) {
+	product, err := v.store.GetProduct(ctx, id)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrProductNotFound)
+	}
+
+	return product, nil
+}
+
+// UpdateProduct update product fields with non zero values of update, only the seller owning
+// the product is allowed to update it. A new cost must still be payable in the currency of
+// every machine with a slot holding the product.
+func (v *vending) UpdateProduct(ctx context.Context, seller string, id string, update models.ProductUpdate) (*models.Product, error) {
+	validation := &vendingmachine.ValidationError{}
+	if update.Available < 0 {
+		validation.Add("available", "must be at least 0")
+	}
+	if update.Cost < 0 {
+		validation.Add("cost", "must be greater than zero")
+	}
+
+	if err := validation.Err(); err != nil {
+		return nil, err
+	}
+
+	var product *models.Product
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := v.ownedProduct(ctx, seller, id)
+		if err != nil {
+			return err
+		}
+
+		if update.Cost != 0 {
+			err = v.checkCost(ctx, id, update.Cost)
+			if err != nil {
+				return err
+			}
+		}
+
+		product, err = v.store.UpdateProduct(ctx, id, update)
+		if err != nil {
+			return translate(err, vendingmachine.ErrProductNotFound)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// checkCost returns ValidationError when cost cannot be paid in the currency of a machine
+// with a slot holding the product.
+func (v *vending) checkCost(ctx context.Context, productID string, cost int) error {
+	slots, err := v.store.ProductSlots(ctx, productID)
+	if err != nil {
+		return err
+	}
+
+	validation := &vendingmachine.ValidationError{}
+	machines := map[string]bool{}
+	currencies := map[string]bool{}
+	for _, slot := range slots {
+		if machines[slot.MachineID] {
+			continue
+		}
+		machines[slot.MachineID] = true
+
+		currency, err := v.machineCurrency(ctx, slot.MachineID)
+		if err != nil {
+			return err
+		}
+
+		// machines sharing a currency reject the cost for the same reason.
+		if cost%currency.Unit() != 0 && !currencies[currency.Code] {
+			validation.Add("cost", costProblem(currency, cost))
+		}
+		currencies[currency.Code] = true
+	}
+
+	return validation.Err()
+}
+
+// DeleteProduct remove product owned by the seller, products still loaded in a slot are
+// kept until every slot holding them is cleared.
+func (v *vending) DeleteProduct(ctx context.Context, seller string, id string) (*models.Product, error) {
+	var product *models.Product
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := v.ownedProduct(ctx, seller, id)
+		if err != nil {
+			return err
+		}
+
+		slots, err := v.store.ProductSlots(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if len(slots) > 0 {
+			return vendingmachine.ErrProductInSlots
+		}
+
+		product, err = v.store.DeleteProduct(ctx, id)
+		if err != nil {
+			return translate(err, vendingmachine.ErrProductNotFound)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+const (
+	defaultProductsLimit = 20
+	maxProductsLimit     = 100
+)
+
+// productCursor is the position of the last product of a page, it is encoded as an opaque
+// string returned to clients to request the next page.
+type productCursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	ID         string `json:"id"`
+	Name       string `json:"n,omitempty"`
+	Cost       int    `json:"c,omitempty"`
+	Available  int    `json:"a,omitempty"`
+}
+
+// ListProducts returns a page of products matching query, cursor is the NextCursor of the
+// previous page or empty for the first page.
+func (v *vending) ListProducts(ctx context.Context, query models.ProductQuery, cursor string) (*models.ProductPage, error) {
+	switch query.SortBy {
+	case "":
+		query.SortBy = models.SortByName
+	case models.SortByName, models.SortByCost, models.SortByAvailable:
+	default:
+		return nil, vendingmachine.ErrInvalidProductQuery
+	}
+
+	if query.Limit < 0 || query.MinCost < 0 || query.MaxCost < 0 {
+		return nil, vendingmachine.ErrInvalidProductQuery
+	}
+
+	if query.Limit == 0 {
+		query.Limit = defaultProductsLimit
+	}
+
+	if query.Limit > maxProductsLimit {
+		query.Limit = maxProductsLimit
+	}
+
+	if cursor != "" {
+		after, err := decodeProductCursor(cursor, &query)
+		if err != nil {
+			return nil, err
+		}
+
+		query.After = after
+	}
+
+	// fetch one more product than requested to know whether there is a next page.
+	limit := query.Limit
+	query.Limit++
+
+	products, err := v.store.ListProducts(ctx, &query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.ProductPage{Products: products}
+	if len(products) > limit {
+		page.Products = products[:limit]
+		page.NextCursor = encodeProductCursor(page.Products[limit-1], &query)
+	}
+
+	return page, nil
+}
+
+func encodeProductCursor(last *models.Product, query *models.ProductQuery) string {
+	buf, _ := json.Marshal(&productCursor{
+		SortBy:     query.SortBy,
+		Descending: query.Descending,
+		ID:         last.ID,
+		Name:       last.Name,
+		Cost:       last.Cost,
+		Available:  last.Available,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeProductCursor returns the last product of the previous page, the cursor must have
+// been issued for the same ordering as query.
+func decodeProductCursor(cursor string, query *models.ProductQuery) (*models.Product, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, vendingmachine.ErrInvalidCursor
+	}
+
+	c := productCursor{}
+	if err := json.Unmarshal(buf, &c); err != nil {
+		return nil, vendingmachine.ErrInvalidCursor
+	}
+
+	if c.ID == "" || c.SortBy != query.SortBy || c.Descending != query.Descending {
+		return nil, vendingmachine.ErrInvalidCursor
+	}
+
+	return &models.Product{ID: c.ID, Name: c.Name, Cost: c.Cost, Available: c.Available}, nil
+}
+
+func (v *vending) ownedProduct(ctx context.Context, seller string, id string) (*models.Product, error) {
+	product, err := v.GetProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if product.SellerId != seller {
+		return nil, vendingmachine.ErrNotProductOwner
+	}
+
+	return product, nil
+}
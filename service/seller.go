@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+// Earnings summarize the seller earnings account in each currency, the balances are what the
+// seller can withdraw.
+func (v *vending) Earnings(ctx context.Context, seller string) ([]*models.Earnings, error) {
+	entries, err := v.ledgerEntries(ctx, models.EarningsAccount(seller))
+	if err != nil {
+		return nil, err
+	}
+
+	return models.NewEarnings(entries), nil
+}
+
+// Payout withdraw amount from the seller earnings in currency and returns the ledger
+// transaction recording it, a zero amount withdraw the whole balance of the currency.
+// Earnings of different currencies are never paid out together.
+func (v *vending) Payout(ctx context.Context, seller string, currency string, amount int) ([]*models.LedgerEntry, error) {
+	if amount < 0 {
+		return nil, vendingmachine.ErrInvalidAmount
+	}
+
+	// currencies no longer configured are accepted so earnings made in them can be withdrawn.
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		validation := &vendingmachine.ValidationError{}
+		validation.Add("currency", "is required")
+		return nil, validation
+	}
+
+	var entries []*models.LedgerEntry
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		if amount == 0 {
+			user, err := v.store.GetUser(ctx, seller)
+			if err != nil {
+				return translate(err, vendingmachine.ErrUserNotFound)
+			}
+
+			amount = user.Earnings[currency]
+		}
+
+		if amount == 0 {
+			return vendingmachine.ErrInsufficientDeposit
+		}
+
+		_, err := v.store.IncrementEarnings(ctx, seller, currency, -amount)
+		if err != nil {
+			if err == storage.ErrConflict {
+				return vendingmachine.ErrInsufficientDeposit
+			}
+			return translate(err, vendingmachine.ErrUserNotFound)
+		}
+
+		entries = models.NewPayoutTransaction(seller, currency, amount)
+
+		return v.record(ctx, entries)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
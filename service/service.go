@@ -0,0 +1,49 @@
+package service
+
+import (
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/notify"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+type vending struct {
+	store      storage.Store
+	notifier   notify.Notifier
+	passwords  *models.PasswordPolicy
+	roles      models.Roles
+	currencies models.Currencies
+	config     *vendingmachine.Config
+}
+
+// New returns vending machine domain service persisting its state in the given store and
+// notifying users through notifier.
+func New(store storage.Store, notifier notify.Notifier, config *vendingmachine.Config) vendingmachine.Service {
+	roles := config.Roles
+	if roles == nil {
+		roles = models.DefaultRoles()
+	}
+
+	currencies := config.Currencies
+	if currencies == nil {
+		currencies = models.DefaultCurrencies()
+	}
+
+	return &vending{
+		store:      store,
+		notifier:   notifier,
+		passwords:  models.NewPasswordPolicy(config.PasswordMinLength, config.PasswordRequiredClasses, config.PasswordDenylist),
+		roles:      roles,
+		currencies: currencies,
+		config:     config,
+	}
+}
+
+// translate replace storage.ErrNotFound with the given domain error.
+func translate(err error, notFound error) error {
+	if err == storage.ErrNotFound {
+		return notFound
+	}
+
+	return err
+}
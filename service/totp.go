@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+)
+
+// EnrolTOTP start two-factor authentication enrolment of the user with a new secret, the
+// second factor is enabled once ConfirmTOTP is given a code of the secret.
+func (v *vending) EnrolTOTP(ctx context.Context, username string) (*models.TOTPEnrolment, error) {
+	var user *models.User
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = v.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		if user.TOTP.Enabled {
+			return vendingmachine.ErrTOTPEnabled
+		}
+
+		user.TOTP = models.TOTP{Secret: models.NewTOTPSecret()}
+
+		return v.updateTOTP(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TOTPEnrolment{
+		Secret: user.TOTP.Secret,
+		URI:    models.TOTPURI(v.config.TOTPIssuer, user.Username, user.TOTP.Secret),
+	}, nil
+}
+
+// ConfirmTOTP enable two-factor authentication of the user once the code proves the
+// secret was enrolled, it returns the recovery codes of the user.
+func (v *vending) ConfirmTOTP(ctx context.Context, username string, code string) ([]string, error) {
+	var codes []string
+
+	err := v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := v.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		if user.TOTP.Enabled {
+			return vendingmachine.ErrTOTPEnabled
+		}
+
+		if user.TOTP.Secret == "" {
+			return vendingmachine.ErrTOTPNotEnrolled
+		}
+
+		if !user.VerifyTOTP(code, time.Now()) {
+			return vendingmachine.ErrInvalidOTP
+		}
+
+		user.TOTP.Enabled = true
+		codes = user.NewRecoveryCodes()
+
+		return v.updateTOTP(ctx, user)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turn off two-factor authentication of the user, code is either a TOTP or
+// a recovery code.
+func (v *vending) DisableTOTP(ctx context.Context, username string, code string) error {
+	return v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := v.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		if !user.TOTP.Enabled {
+			return vendingmachine.ErrTOTPNotEnrolled
+		}
+
+		if !user.VerifyTOTP(code, time.Now()) && !user.UseRecoveryCode(code) {
+			return vendingmachine.ErrInvalidOTP
+		}
+
+		user.TOTP = models.TOTP{}
+
+		return v.updateTOTP(ctx, user)
+	})
+}
+
+// verifySecondFactor check a TOTP or recovery code of the user, the code is consumed so it
+// cannot be used again.
+func (v *vending) verifySecondFactor(ctx context.Context, username string, code string) error {
+	return v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		user, err := v.GetUser(ctx, username)
+		if err != nil {
+			return err
+		}
+
+		if !user.VerifyTOTP(code, time.Now()) && !user.UseRecoveryCode(code) {
+			return vendingmachine.ErrInvalidOTP
+		}
+
+		return v.updateTOTP(ctx, user)
+	})
+}
+
+// updateTOTP save the two-factor authentication fields of the user, leaving the others to
+// concurrent updates.
+func (v *vending) updateTOTP(ctx context.Context, user *models.User) error {
+	return translate(v.store.UpdateTOTP(ctx, user.Username, user.TOTP), vendingmachine.ErrUserNotFound)
+}
@@ -0,0 +1,428 @@
+package service
+
+import (
+	"context"
+
+	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/bcmmbaga/vending-machine/storage"
+)
+
+// Deposit add coins and banknotes inserted into the machine to the buyer deposit balance, they
+// must be of the machine currency. The coins refill the machine cassette and those it has no
+// room for drop into the cashbox with the banknotes. A deposit is held by a single machine in
+// a single currency, adding to a deposit inserted into another machine or counted in another
+// currency is rejected.
+func (v *vending) Deposit(ctx context.Context, username string, machineID string, coins models.Coins) (*models.User, error) {
+	user, err := v.GetUser(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	machine, err := v.vendingMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	currency, err := v.currency(machine)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate coins before touching the stored balance.
+	err = user.AddDeposit(currency, coins)
+	if err != nil {
+		return nil, err
+	}
+
+	err = v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		err := v.bindDeposit(ctx, username, machine)
+		if err != nil {
+			return err
+		}
+
+		user, err = v.store.IncrementDeposit(ctx, username, coins.Sum())
+		if err != nil {
+			return translate(err, vendingmachine.ErrUserNotFound)
+		}
+
+		err = v.insertCoins(ctx, machineID, currency, models.NewCoinInventory(coins))
+		if err != nil {
+			return err
+		}
+
+		return v.record(ctx, models.NewDepositTransaction(username, machine.Currency, coins.Sum()))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ResetDeposit zero the buyer deposit and refund it as coins paid out of the cassette of the
+// machine holding the deposit, the refund is recorded unless there was nothing to refund. The
+// deposit is left untouched when the balance cannot be paid back with exact change.
+func (v *vending) ResetDeposit(ctx context.Context, username string, machineID string) (*models.Refund, error) {
+	machine, err := v.vendingMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	var refund *models.Refund
+
+	err = v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		err := v.bindDeposit(ctx, username, machine)
+		if err != nil {
+			return err
+		}
+
+		user, err := v.store.SetDeposit(ctx, username, 0)
+		if err != nil {
+			return translate(err, vendingmachine.ErrUserNotFound)
+		}
+
+		coins, err := v.payOut(ctx, machineID, user.Deposit)
+		if err != nil {
+			return err
+		}
+
+		refund = models.NewRefund(username, machine, coins)
+		if refund.Amount == 0 {
+			return nil
+		}
+
+		err = v.store.CreateRefund(ctx, refund)
+		if err != nil {
+			return err
+		}
+
+		return v.record(ctx, models.NewRefundTransaction(username, refund.Currency, refund.Amount, ""))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// Buy debit the buyer, decrement the slot count and credit the seller as a single
+// transaction. In session vend mode the balance left is then paid out of the machine coins
+// as change and the deposit is zeroed, in wallet vend mode it is kept as deposit. Each write
+// is guarded so concurrent purchases can never overspend the deposit, empty the slot below
+// zero or pay out coins the machine does not hold, and any failure, including exact change
+// not being available, aborts the transaction leaving balances, stock and coins untouched.
+//
+// The purchase is recorded as an order within the same transaction and returned as receipt.
+func (v *vending) Buy(ctx context.Context, username string, machineID string, slot string, quantity int) (*models.Order, error) {
+	if quantity <= 0 {
+		return nil, vendingmachine.ErrInvalidQuantity
+	}
+
+	machine, err := v.vendingMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	code := models.NormalizeSlotCode(slot)
+	product, err := v.slotProduct(ctx, machineID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	order := models.NewOrder(username, product, quantity)
+	order.MachineID = machine.ID
+	order.Slot = code
+	order.Currency = machine.Currency
+
+	err = v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		order.Change, order.Balance, err = v.purchase(ctx, username, machine, []*models.Order{order}, order.ID)
+		if err != nil {
+			return err
+		}
+
+		return v.store.CreateOrder(ctx, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// Checkout buy every item of the cart from the machine as a single transaction, either every
+// item is bought or none is. The total of the cart is debited from the buyer at once and the
+// balance left is paid as one change like Buy. Items listing the same slot are merged.
+func (v *vending) Checkout(ctx context.Context, username string, machineID string, items []models.CartItem) (*models.Checkout, error) {
+	if len(items) == 0 {
+		return nil, vendingmachine.ErrEmptyCart
+	}
+
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return nil, vendingmachine.ErrInvalidQuantity
+		}
+	}
+
+	machine, err := v.vendingMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, merged := models.MergeCartItems(items)
+
+	products := make([]*models.Product, len(codes))
+	quantities := make([]int, len(codes))
+	for i, code := range codes {
+		product, err := v.slotProduct(ctx, machineID, code)
+		if err != nil {
+			return nil, err
+		}
+
+		products[i] = product
+		quantities[i] = merged[code]
+	}
+
+	checkout := models.NewCheckout(username, machine, codes, products, quantities)
+
+	err = v.store.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		checkout.Change, checkout.Balance, err = v.purchase(ctx, username, machine, checkout.Items, checkout.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, order := range checkout.Items {
+			order.Balance = checkout.Balance
+
+			err = v.store.CreateOrder(ctx, order)
+			if err != nil {
+				return err
+			}
+		}
+
+		return v.store.CreateCheckout(ctx, checkout)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return checkout, nil
+}
+
+// bindDeposit check the deposit of the user can be used at the machine, which then holds it
+// in the machine currency.
+func (v *vending) bindDeposit(ctx context.Context, username string, machine *models.Machine) error {
+	_, err := v.store.BindDeposit(ctx, username, machine.ID, machine.Currency)
+	if err != storage.ErrConflict {
+		return translate(err, vendingmachine.ErrUserNotFound)
+	}
+
+	user, err := v.GetUser(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if user.DepositCurrency != "" && user.DepositCurrency != machine.Currency {
+		return vendingmachine.ErrDepositCurrency
+	}
+
+	return vendingmachine.ErrDepositElsewhere
+}
+
+// vendingMachine returns the machine with the given ID if it is active.
+func (v *vending) vendingMachine(ctx context.Context, machineID string) (*models.Machine, error) {
+	machine, err := v.GetMachine(ctx, machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	if machine.Status != models.MachineActive {
+		return nil, vendingmachine.ErrMachineUnavailable
+	}
+
+	return machine, nil
+}
+
+// slotProduct returns the product loaded in the slot of the machine.
+func (v *vending) slotProduct(ctx context.Context, machineID string, code string) (*models.Product, error) {
+	slot, err := v.GetSlot(ctx, machineID, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if slot.ProductID == "" {
+		return nil, vendingmachine.ErrSlotEmpty
+	}
+
+	return v.GetProduct(ctx, slot.ProductID)
+}
+
+// purchase apply the orders of the buyer from the machine within the transaction of ctx, it
+// returns the change paid and the deposit left. The total of the orders is debited at once so
+// the deposit must cover all of them and be held by the machine, the change refund is
+// recorded against refundOf.
+func (v *vending) purchase(ctx context.Context, username string, machine *models.Machine, orders []*models.Order, refundOf string) (models.CoinInventory, int, error) {
+	total := 0
+	for _, order := range orders {
+		slot, err := v.store.IncrementSlotCount(ctx, order.MachineID, order.Slot, -order.Quantity)
+		if err != nil {
+			if err == storage.ErrConflict {
+				return nil, 0, vendingmachine.ErrInsufficientStock
+			}
+			return nil, 0, translate(err, vendingmachine.ErrSlotNotFound)
+		}
+
+		// the slot may have been loaded with another product since the order was made, it
+		// holds none of the ordered product then.
+		if slot.ProductID != order.Product.ID {
+			return nil, 0, vendingmachine.ErrInsufficientStock
+		}
+
+		total += order.Total
+	}
+
+	err := v.bindDeposit(ctx, username, machine)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	buyer, err := v.store.IncrementDeposit(ctx, username, -total)
+	if err != nil {
+		if err == storage.ErrConflict {
+			return nil, 0, vendingmachine.ErrInsufficientDeposit
+		}
+		return nil, 0, translate(err, vendingmachine.ErrUserNotFound)
+	}
+
+	for _, order := range orders {
+		_, err = v.store.IncrementEarnings(ctx, order.Product.SellerId, order.Currency, order.Total)
+		if err != nil {
+			return nil, 0, translate(err, vendingmachine.ErrSellerNotFound)
+		}
+
+		err = v.record(ctx, models.NewPurchaseTransaction(order))
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	balance := buyer.Deposit
+	if v.config.VendMode != vendingmachine.VendModeSession || balance == 0 {
+		return nil, balance, nil
+	}
+
+	change, err := v.payOut(ctx, machine.ID, balance)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, err = v.store.IncrementDeposit(ctx, username, -balance)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	err = v.record(ctx, models.NewRefundTransaction(username, machine.Currency, balance, refundOf))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return change, 0, nil
+}
+
+const (
+	defaultOrdersLimit = 20
+	maxOrdersLimit     = 100
+)
+
+// Orders returns a page of the buyer orders newest first, cursor is the NextCursor of the
+// previous page or empty for the first page.
+func (v *vending) Orders(ctx context.Context, username string, cursor string, limit int) (*models.OrderPage, error) {
+	if limit <= 0 {
+		limit = defaultOrdersLimit
+	}
+
+	if limit > maxOrdersLimit {
+		limit = maxOrdersLimit
+	}
+
+	// fetch one more order than requested to know whether there is a next page.
+	query := &models.OrderQuery{Buyer: username, Limit: limit + 1}
+
+	if cursor != "" {
+		before, err := v.Order(ctx, username, cursor)
+		if err != nil {
+			if err == vendingmachine.ErrOrderNotFound {
+				return nil, vendingmachine.ErrInvalidCursor
+			}
+			return nil, err
+		}
+
+		query.Before = before
+	}
+
+	orders, err := v.store.ListOrders(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		page.NextCursor = page.Orders[limit-1].ID
+	}
+
+	return page, nil
+}
+
+// Order returns an order placed by the buyer, orders of other buyers are reported as not found.
+func (v *vending) Order(ctx context.Context, username string, id string) (*models.Order, error) {
+	order, err := v.store.GetOrder(ctx, id)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrOrderNotFound)
+	}
+
+	if order.Buyer != username {
+		return nil, vendingmachine.ErrOrderNotFound
+	}
+
+	return order, nil
+}
+
+// CheckoutReceipt returns the checkout of the buyer with the given ID.
+func (v *vending) CheckoutReceipt(ctx context.Context, username string, id string) (*models.Checkout, error) {
+	checkout, err := v.store.GetCheckout(ctx, id)
+	if err != nil {
+		return nil, translate(err, vendingmachine.ErrCheckoutNotFound)
+	}
+
+	if checkout.Buyer != username {
+		return nil, vendingmachine.ErrCheckoutNotFound
+	}
+
+	return checkout, nil
+}
+
+// payOut remove the fewest coins summing to amount from the machine cassette, it returns
+// models.ErrExactChangeUnavailable when the coins held cannot pay the exact amount.
+func (v *vending) payOut(ctx context.Context, machineID string, amount int) (models.CoinInventory, error) {
+	coins, err := v.store.GetCoins(ctx, models.CassetteID(machineID))
+	if err != nil {
+		return nil, err
+	}
+
+	change, err := coins.MakeChange(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = v.store.IncrementCoins(ctx, models.CassetteID(machineID), change.Negate())
+	if err != nil {
+		if err == storage.ErrConflict {
+			return nil, models.ErrExactChangeUnavailable
+		}
+		return nil, err
+	}
+
+	return change, nil
+}
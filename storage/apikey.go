@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// APIKeyStore describe persistence of user API keys.
+type APIKeyStore interface {
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+
+	// FindAPIKey returns the API key with the given hash.
+	FindAPIKey(ctx context.Context, hash string) (*models.APIKey, error)
+
+	// ListAPIKeys returns every API key of the user including revoked ones, oldest first.
+	ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error)
+
+	// RevokeAPIKey mark the API key of the user as revoked, it returns ErrNotFound when
+	// the user has no such key.
+	RevokeAPIKey(ctx context.Context, username string, id string) error
+
+	// RevokeAPIKeys mark every API key of the user as revoked.
+	RevokeAPIKeys(ctx context.Context, username string) error
+
+	// TouchAPIKey record the key was used at the given time.
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+}
+
+func (c *Connection) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	_, err := c.apiKeys().InsertOne(ctx, key)
+	return duplicate(err)
+}
+
+func (c *Connection) FindAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	key := models.APIKey{}
+
+	err := c.apiKeys().FindOne(ctx, bson.M{"hash": hash}).Decode(&key)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &key, nil
+}
+
+func (c *Connection) ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error) {
+	cur, err := c.apiKeys().Find(ctx, bson.M{"username": username},
+		options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []*models.APIKey{}
+	if err := cur.All(ctx, &keys); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (c *Connection) RevokeAPIKey(ctx context.Context, username string, id string) error {
+	res, err := c.apiKeys().UpdateOne(ctx, bson.M{"_id": id, "username": username}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *Connection) RevokeAPIKeys(ctx context.Context, username string) error {
+	_, err := c.apiKeys().UpdateMany(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+func (c *Connection) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	_, err := c.apiKeys().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastusedat": at}})
+	return err
+}
+
+func (m *Memory) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	defer m.lock(ctx)()
+
+	for _, stored := range m.data.apiKeys {
+		if stored.ID == key.ID || stored.Hash == key.Hash {
+			return ErrDuplicate
+		}
+	}
+
+	m.data.apiKeys[key.ID] = *key
+
+	return nil
+}
+
+func (m *Memory) FindAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	defer m.lock(ctx)()
+
+	for _, key := range m.data.apiKeys {
+		if key.Hash == hash {
+			return &key, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (m *Memory) ListAPIKeys(ctx context.Context, username string) ([]*models.APIKey, error) {
+	defer m.lock(ctx)()
+
+	keys := []*models.APIKey{}
+	for _, key := range m.data.apiKeys {
+		key := key
+		if key.Username == username {
+			keys = append(keys, &key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].ID < keys[j].ID
+		}
+
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (m *Memory) RevokeAPIKey(ctx context.Context, username string, id string) error {
+	defer m.lock(ctx)()
+
+	key, ok := m.data.apiKeys[id]
+	if !ok || key.Username != username {
+		return ErrNotFound
+	}
+
+	key.Revoked = true
+	m.data.apiKeys[id] = key
+
+	return nil
+}
+
+func (m *Memory) RevokeAPIKeys(ctx context.Context, username string) error {
+	defer m.lock(ctx)()
+
+	for id, key := range m.data.apiKeys {
+		if key.Username == username {
+			key.Revoked = true
+			m.data.apiKeys[id] = key
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	defer m.lock(ctx)()
+
+	key, ok := m.data.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	key.LastUsedAt = &at
+	m.data.apiKeys[id] = key
+
+	return nil
+}
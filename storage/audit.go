@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditStore describe persistence of the administrative audit trail, entries are never
+// updated or deleted.
+type AuditStore interface {
+	AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error
+	GetAuditEntry(ctx context.Context, id string) (*models.AuditEntry, error)
+
+	// ListAuditEntries returns up to query.Limit entries matching the query, newest first.
+	ListAuditEntries(ctx context.Context, query *models.AuditQuery) ([]*models.AuditEntry, error)
+}
+
+func (c *Connection) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	_, err := c.audit().InsertOne(ctx, entry)
+	return duplicate(err)
+}
+
+func (c *Connection) GetAuditEntry(ctx context.Context, id string) (*models.AuditEntry, error) {
+	entry := models.AuditEntry{}
+
+	err := c.audit().FindOne(ctx, bson.M{"_id": id}).Decode(&entry)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &entry, nil
+}
+
+func (c *Connection) ListAuditEntries(ctx context.Context, query *models.AuditQuery) ([]*models.AuditEntry, error) {
+	filter := bson.M{}
+
+	if query.Actor != "" {
+		filter["actor"] = query.Actor
+	}
+
+	if query.Target != "" {
+		filter["target"] = query.Target
+	}
+
+	if query.Before != nil {
+		filter["$or"] = bson.A{
+			bson.M{"createdat": bson.M{"$lt": query.Before.CreatedAt}},
+			bson.M{"createdat": query.Before.CreatedAt, "_id": bson.M{"$lt": query.Before.ID}},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}, {Key: "_id", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+
+	cur, err := c.audit().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*models.AuditEntry{}
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (m *Memory) AppendAuditEntry(ctx context.Context, entry *models.AuditEntry) error {
+	defer m.lock(ctx)()
+
+	for _, stored := range m.data.audit {
+		if stored.ID == entry.ID {
+			return ErrDuplicate
+		}
+	}
+
+	m.data.audit = append(m.data.audit, *entry)
+
+	return nil
+}
+
+func (m *Memory) GetAuditEntry(ctx context.Context, id string) (*models.AuditEntry, error) {
+	defer m.lock(ctx)()
+
+	for _, entry := range m.data.audit {
+		if entry.ID == id {
+			return &entry, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (m *Memory) ListAuditEntries(ctx context.Context, query *models.AuditQuery) ([]*models.AuditEntry, error) {
+	defer m.lock(ctx)()
+
+	entries := []*models.AuditEntry{}
+	for _, entry := range m.data.audit {
+		entry := entry
+
+		if !query.Matches(&entry) {
+			continue
+		}
+
+		if query.Before != nil && !entry.Older(query.Before) {
+			continue
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[j].Older(entries[i])
+	})
+
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CashStore describe persistence of coins collected from, or added to, machines.
+type CashStore interface {
+	CreateCashMovement(ctx context.Context, movement *models.CashMovement) error
+
+	// ListCashMovements returns the cash movements of the machine newest first.
+	ListCashMovements(ctx context.Context, machineID string) ([]*models.CashMovement, error)
+}
+
+func (c *Connection) CreateCashMovement(ctx context.Context, movement *models.CashMovement) error {
+	_, err := c.cashMovements().InsertOne(ctx, movement)
+	return duplicate(err)
+}
+
+func (c *Connection) ListCashMovements(ctx context.Context, machineID string) ([]*models.CashMovement, error) {
+	cur, err := c.cashMovements().Find(ctx, bson.M{"machineid": machineID},
+		options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}, {Key: "_id", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	movements := []*models.CashMovement{}
+	if err := cur.All(ctx, &movements); err != nil {
+		return nil, err
+	}
+
+	return movements, nil
+}
+
+func (m *Memory) CreateCashMovement(ctx context.Context, movement *models.CashMovement) error {
+	defer m.lock(ctx)()
+
+	m.data.cashMovements = append(m.data.cashMovements, *movement)
+
+	return nil
+}
+
+func (m *Memory) ListCashMovements(ctx context.Context, machineID string) ([]*models.CashMovement, error) {
+	defer m.lock(ctx)()
+
+	// walk the movements newest first so movements recorded in the same millisecond keep
+	// that order.
+	movements := []*models.CashMovement{}
+	for i := len(m.data.cashMovements) - 1; i >= 0; i-- {
+		movement := m.data.cashMovements[i]
+		if movement.MachineID == machineID {
+			movements = append(movements, &movement)
+		}
+	}
+
+	sort.SliceStable(movements, func(i, j int) bool {
+		return movements[i].CreatedAt.After(movements[j].CreatedAt)
+	})
+
+	return movements, nil
+}
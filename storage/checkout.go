@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// CheckoutStore describe persistence of checkout receipts, their line items are stored both
+// in the checkout and as orders.
+type CheckoutStore interface {
+	CreateCheckout(ctx context.Context, checkout *models.Checkout) error
+	GetCheckout(ctx context.Context, id string) (*models.Checkout, error)
+}
+
+func (c *Connection) CreateCheckout(ctx context.Context, checkout *models.Checkout) error {
+	_, err := c.checkouts().InsertOne(ctx, checkout)
+	return duplicate(err)
+}
+
+func (c *Connection) GetCheckout(ctx context.Context, id string) (*models.Checkout, error) {
+	checkout := models.Checkout{}
+
+	err := c.checkouts().FindOne(ctx, bson.M{"_id": id}).Decode(&checkout)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &checkout, nil
+}
+
+func (m *Memory) CreateCheckout(ctx context.Context, checkout *models.Checkout) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.checkouts[checkout.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.checkouts[checkout.ID] = copyCheckout(checkout)
+
+	return nil
+}
+
+func (m *Memory) GetCheckout(ctx context.Context, id string) (*models.Checkout, error) {
+	defer m.lock(ctx)()
+
+	checkout, ok := m.data.checkouts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	copied := copyCheckout(&checkout)
+	return &copied, nil
+}
+
+// copyCheckout returns a copy of the checkout not sharing its line items.
+func copyCheckout(checkout *models.Checkout) models.Checkout {
+	copied := *checkout
+	copied.Items = make([]*models.Order, len(checkout.Items))
+	for i, item := range checkout.Items {
+		order := *item
+		copied.Items[i] = &order
+	}
+
+	return copied
+}
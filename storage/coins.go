@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CoinStore describe persistence of coin inventories held by the machine.
+type CoinStore interface {
+	// GetCoins returns the inventory identified by id, a missing inventory is empty.
+	GetCoins(ctx context.Context, id string) (models.CoinInventory, error)
+
+	// IncrementCoins add coins count to the inventory and returns the updated inventory,
+	// removing more coins than held is rejected with ErrConflict.
+	IncrementCoins(ctx context.Context, id string, coins models.CoinInventory) (models.CoinInventory, error)
+}
+
+type coinInventoryDocument struct {
+	ID    string               `bson:"_id"`
+	Coins models.CoinInventory `bson:"coins"`
+}
+
+func (c *Connection) GetCoins(ctx context.Context, id string) (models.CoinInventory, error) {
+	doc := coinInventoryDocument{}
+
+	err := c.coins().FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if err != nil {
+		if notFound(err) == ErrNotFound {
+			return models.CoinInventory{}, nil
+		}
+		return nil, err
+	}
+
+	if doc.Coins == nil {
+		doc.Coins = models.CoinInventory{}
+	}
+
+	return doc.Coins, nil
+}
+
+func (c *Connection) IncrementCoins(ctx context.Context, id string, coins models.CoinInventory) (models.CoinInventory, error) {
+	filter := bson.M{"_id": id}
+	inc := bson.M{}
+	removing := false
+
+	for coin, count := range coins {
+		key := fmt.Sprintf("coins.%d", coin)
+		inc[key] = count
+
+		if count < 0 {
+			filter[key] = bson.M{"$gte": -count}
+			removing = true
+		}
+	}
+
+	if len(inc) == 0 {
+		return c.GetCoins(ctx, id)
+	}
+
+	// only upsert when adding coins, a guarded removal that does not match must not
+	// create a new inventory.
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(!removing)
+
+	doc := coinInventoryDocument{}
+	err := c.coins().FindOneAndUpdate(ctx, filter, bson.M{"$inc": inc}, opts).Decode(&doc)
+	if err != nil {
+		if notFound(err) == ErrNotFound {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	return doc.Coins, nil
+}
+
+func (m *Memory) GetCoins(ctx context.Context, id string) (models.CoinInventory, error) {
+	defer m.lock(ctx)()
+
+	inventory := models.CoinInventory{}
+	for coin, count := range m.data.coins[id] {
+		inventory[coin] = count
+	}
+
+	return inventory, nil
+}
+
+func (m *Memory) IncrementCoins(ctx context.Context, id string, coins models.CoinInventory) (models.CoinInventory, error) {
+	defer m.lock(ctx)()
+
+	stored := m.data.coins[id]
+
+	for coin, count := range coins {
+		if stored[coin]+count < 0 {
+			return nil, ErrConflict
+		}
+	}
+
+	inventory := models.CoinInventory{}
+	for coin, count := range stored {
+		inventory[coin] = count
+	}
+
+	for coin, count := range coins {
+		inventory[coin] += count
+	}
+
+	m.data.coins[id] = inventory
+
+	updated := models.CoinInventory{}
+	for coin, count := range inventory {
+		updated[coin] = count
+	}
+
+	return updated, nil
+}
@@ -5,12 +5,16 @@ import (
 	"time"
 
 	vendingmachine "github.com/bcmmbaga/vending-machine"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Connection is a Store backed by mongo db.
 type Connection struct {
 	*mongo.Client
+
+	db *mongo.Database
 }
 
 // Dial connect to mongo db storage engine usign specified database URI in config.
@@ -23,5 +27,212 @@ func Dial(config *vendingmachine.Config) (*Connection, error) {
 		return nil, err
 	}
 
-	return &Connection{Client: client}, nil
+	conn := &Connection{Client: client, db: client.Database(config.DatabaseName)}
+
+	err = conn.ensureIndexes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// ensureIndexes create indexes backing the queries made by the store, creating an index
+// that already exists is a no-op.
+func (c *Connection) ensureIndexes(ctx context.Context) error {
+	// usernames are normalized to lower case before reaching the store but accounts created
+	// before normalization may still be stored in mixed case. The case insensitive unique
+	// index keeps new usernames from colliding with them, and fails to build when stored
+	// usernames already collide so they are resolved before the server starts.
+	_, err := c.users().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys: bson.D{{Key: "username", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("username_ci").
+				SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.products().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "cost", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "available", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "sellerid", Value: 1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.slots().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "machineid", Value: 1}, {Key: "code", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.cashMovements().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "machineid", Value: 1}, {Key: "createdat", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.orders().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "buyer", Value: 1}, {Key: "createdat", Value: -1}, {Key: "_id", Value: -1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.ledger().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "account", Value: 1}, {Key: "createdat", Value: 1}, {Key: "_id", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.sessions().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "username", Value: 1}, {Key: "status", Value: 1}, {Key: "createdat", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.audit().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "createdat", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "target", Value: 1}, {Key: "createdat", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "createdat", Value: -1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.apiKeys().Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "createdat", Value: 1}, {Key: "_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// expired password resets and idempotent requests are useless, let mongo delete them.
+	_, err = c.passwordResets().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresat", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.idempotentRequests().Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresat", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+
+	return err
+}
+
+// WithTransaction runs fn inside a mongo multi-document transaction, it requires the
+// database to be a replica set. Calls nested in a running transaction join it.
+func (c *Connection) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	return c.Client.UseSession(ctx, func(sessCtx mongo.SessionContext) error {
+		_, err := sessCtx.WithTransaction(sessCtx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+			return nil, fn(sessCtx)
+		})
+
+		return err
+	})
+}
+
+func (c *Connection) Close(ctx context.Context) error {
+	return c.Client.Disconnect(ctx)
+}
+
+func (c *Connection) users() *mongo.Collection {
+	return c.db.Collection("users")
+}
+
+func (c *Connection) products() *mongo.Collection {
+	return c.db.Collection("products")
+}
+
+func (c *Connection) machines() *mongo.Collection {
+	return c.db.Collection("machines")
+}
+
+func (c *Connection) slots() *mongo.Collection {
+	return c.db.Collection("slots")
+}
+
+func (c *Connection) sessions() *mongo.Collection {
+	return c.db.Collection("sessions")
+}
+
+func (c *Connection) loginAttempts() *mongo.Collection {
+	return c.db.Collection("loginattempts")
+}
+
+func (c *Connection) audit() *mongo.Collection {
+	return c.db.Collection("audit")
+}
+
+func (c *Connection) passwordResets() *mongo.Collection {
+	return c.db.Collection("passwordresets")
+}
+
+func (c *Connection) apiKeys() *mongo.Collection {
+	return c.db.Collection("apikeys")
+}
+
+func (c *Connection) idempotentRequests() *mongo.Collection {
+	return c.db.Collection("idempotentrequests")
+}
+
+func (c *Connection) coins() *mongo.Collection {
+	return c.db.Collection("coins")
+}
+
+func (c *Connection) cashMovements() *mongo.Collection {
+	return c.db.Collection("cashmovements")
+}
+
+func (c *Connection) refunds() *mongo.Collection {
+	return c.db.Collection("refunds")
+}
+
+func (c *Connection) checkouts() *mongo.Collection {
+	return c.db.Collection("checkouts")
+}
+
+func (c *Connection) orders() *mongo.Collection {
+	return c.db.Collection("orders")
+}
+
+func (c *Connection) ledger() *mongo.Collection {
+	return c.db.Collection("ledger")
+}
+
+// notFound translate mongo.ErrNoDocuments into ErrNotFound.
+func notFound(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+
+	return err
+}
+
+// duplicate translate mongo duplicate key errors into ErrDuplicate.
+func duplicate(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+
+	return err
 }
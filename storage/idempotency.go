@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// IdempotencyStore describe persistence of requests made with an Idempotency-Key.
+type IdempotencyStore interface {
+	// CreateIdempotentRequest save the pending request, it returns ErrDuplicate when a
+	// request with the same ID exists.
+	CreateIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error
+	GetIdempotentRequest(ctx context.Context, id string) (*models.IdempotentRequest, error)
+
+	// ReplaceIdempotentRequest replace the stored request held by lease with req, it returns
+	// ErrConflict when the stored request was completed or taken over meanwhile.
+	ReplaceIdempotentRequest(ctx context.Context, req *models.IdempotentRequest, lease string) error
+
+	// CompleteIdempotentRequest save the response of the pending request, it returns
+	// ErrConflict when the request lease was taken over by a retry.
+	CompleteIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error
+
+	// DeleteIdempotentRequest forget the pending request while it is held by its lease,
+	// deleting a missing or taken over request is a no-op.
+	DeleteIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error
+}
+
+func (c *Connection) CreateIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	_, err := c.idempotentRequests().InsertOne(ctx, req)
+	return duplicate(err)
+}
+
+func (c *Connection) GetIdempotentRequest(ctx context.Context, id string) (*models.IdempotentRequest, error) {
+	req := models.IdempotentRequest{}
+
+	err := c.idempotentRequests().FindOne(ctx, bson.M{"_id": id}).Decode(&req)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &req, nil
+}
+
+func (c *Connection) ReplaceIdempotentRequest(ctx context.Context, req *models.IdempotentRequest, lease string) error {
+	res, err := c.idempotentRequests().ReplaceOne(ctx, bson.M{"_id": req.ID, "lease": lease}, req)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+func (c *Connection) CompleteIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	filter := bson.M{"_id": req.ID, "lease": req.Lease, "completed": false}
+
+	res, err := c.idempotentRequests().UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"completed":   true,
+		"status":      req.Status,
+		"contenttype": req.ContentType,
+		"body":        req.Body,
+	}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+func (c *Connection) DeleteIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	_, err := c.idempotentRequests().DeleteOne(ctx, bson.M{"_id": req.ID, "lease": req.Lease, "completed": false})
+	return err
+}
+
+func (m *Memory) CreateIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.idempotentRequests[req.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.idempotentRequests[req.ID] = *req
+
+	return nil
+}
+
+func (m *Memory) GetIdempotentRequest(ctx context.Context, id string) (*models.IdempotentRequest, error) {
+	defer m.lock(ctx)()
+
+	req, ok := m.data.idempotentRequests[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &req, nil
+}
+
+func (m *Memory) ReplaceIdempotentRequest(ctx context.Context, req *models.IdempotentRequest, lease string) error {
+	defer m.lock(ctx)()
+
+	stored, ok := m.data.idempotentRequests[req.ID]
+	if !ok || stored.Lease != lease {
+		return ErrConflict
+	}
+
+	m.data.idempotentRequests[req.ID] = *req
+
+	return nil
+}
+
+func (m *Memory) CompleteIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	defer m.lock(ctx)()
+
+	stored, ok := m.data.idempotentRequests[req.ID]
+	if !ok || stored.Lease != req.Lease || stored.Completed {
+		return ErrConflict
+	}
+
+	stored.Complete(req.Status, req.ContentType, append([]byte(nil), req.Body...))
+	m.data.idempotentRequests[req.ID] = stored
+
+	return nil
+}
+
+func (m *Memory) DeleteIdempotentRequest(ctx context.Context, req *models.IdempotentRequest) error {
+	defer m.lock(ctx)()
+
+	stored, ok := m.data.idempotentRequests[req.ID]
+	if ok && stored.Lease == req.Lease && !stored.Completed {
+		delete(m.data.idempotentRequests, req.ID)
+	}
+
+	return nil
+}
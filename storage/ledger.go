@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LedgerStore describe persistence of the append-only ledger, entries are never updated
+// nor deleted.
+type LedgerStore interface {
+	AppendLedgerEntries(ctx context.Context, entries ...*models.LedgerEntry) error
+
+	// LedgerEntries returns every entry of the account, oldest first.
+	LedgerEntries(ctx context.Context, account string) ([]*models.LedgerEntry, error)
+
+	// LedgerBalances returns the sum of entries of every account in each currency.
+	LedgerBalances(ctx context.Context) (models.LedgerBalances, error)
+}
+
+func (c *Connection) AppendLedgerEntries(ctx context.Context, entries ...*models.LedgerEntry) error {
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		docs[i] = entry
+	}
+
+	_, err := c.ledger().InsertMany(ctx, docs)
+	return duplicate(err)
+}
+
+func (c *Connection) LedgerEntries(ctx context.Context, account string) ([]*models.LedgerEntry, error) {
+	cur, err := c.ledger().Find(ctx, bson.M{"account": account},
+		options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*models.LedgerEntry{}
+	if err := cur.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (c *Connection) LedgerBalances(ctx context.Context) (models.LedgerBalances, error) {
+	cur, err := c.ledger().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":     bson.M{"account": "$account", "currency": "$currency"},
+			"balance": bson.M{"$sum": "$amount"},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := []struct {
+		ID struct {
+			Account  string `bson:"account"`
+			Currency string `bson:"currency"`
+		} `bson:"_id"`
+		Balance int `bson:"balance"`
+	}{}
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	balances := models.LedgerBalances{}
+	for _, result := range results {
+		balances.Add(result.ID.Account, result.ID.Currency, result.Balance)
+	}
+
+	return balances, nil
+}
+
+func (m *Memory) AppendLedgerEntries(ctx context.Context, entries ...*models.LedgerEntry) error {
+	defer m.lock(ctx)()
+
+	for _, entry := range entries {
+		m.data.ledger = append(m.data.ledger, *entry)
+	}
+
+	return nil
+}
+
+func (m *Memory) LedgerEntries(ctx context.Context, account string) ([]*models.LedgerEntry, error) {
+	defer m.lock(ctx)()
+
+	// entries are appended in the order they happened.
+	entries := []*models.LedgerEntry{}
+	for _, entry := range m.data.ledger {
+		if entry.Account == account {
+			entry := entry
+			entries = append(entries, &entry)
+		}
+	}
+
+	return entries, nil
+}
+
+func (m *Memory) LedgerBalances(ctx context.Context) (models.LedgerBalances, error) {
+	defer m.lock(ctx)()
+
+	balances := models.LedgerBalances{}
+	for _, entry := range m.data.ledger {
+		balances.Add(entry.Account, entry.Currency, entry.Amount)
+	}
+
+	return balances, nil
+}
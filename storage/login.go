@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LoginAttemptStore describe persistence of failed login tracking.
+type LoginAttemptStore interface {
+	GetLoginAttempts(ctx context.Context, id string) (*models.LoginAttempts, error)
+
+	// SaveLoginAttempts create or replace the login attempts.
+	SaveLoginAttempts(ctx context.Context, attempts *models.LoginAttempts) error
+
+	// DeleteLoginAttempts forget the login attempts, deleting missing attempts is a no-op.
+	DeleteLoginAttempts(ctx context.Context, id string) error
+}
+
+func (c *Connection) GetLoginAttempts(ctx context.Context, id string) (*models.LoginAttempts, error) {
+	attempts := models.LoginAttempts{}
+
+	err := c.loginAttempts().FindOne(ctx, bson.M{"_id": id}).Decode(&attempts)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &attempts, nil
+}
+
+func (c *Connection) SaveLoginAttempts(ctx context.Context, attempts *models.LoginAttempts) error {
+	_, err := c.loginAttempts().ReplaceOne(ctx, bson.M{"_id": attempts.ID}, attempts, options.Replace().SetUpsert(true))
+	return err
+}
+
+func (c *Connection) DeleteLoginAttempts(ctx context.Context, id string) error {
+	_, err := c.loginAttempts().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func (m *Memory) GetLoginAttempts(ctx context.Context, id string) (*models.LoginAttempts, error) {
+	defer m.lock(ctx)()
+
+	attempts, ok := m.data.loginAttempts[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &attempts, nil
+}
+
+func (m *Memory) SaveLoginAttempts(ctx context.Context, attempts *models.LoginAttempts) error {
+	defer m.lock(ctx)()
+
+	m.data.loginAttempts[attempts.ID] = *attempts
+
+	return nil
+}
+
+func (m *Memory) DeleteLoginAttempts(ctx context.Context, id string) error {
+	defer m.lock(ctx)()
+
+	delete(m.data.loginAttempts, id)
+
+	return nil
+}
@@ -0,0 +1,375 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MachineStore describe persistence of machines and of their slots.
+type MachineStore interface {
+	CreateMachine(ctx context.Context, machine *models.Machine) error
+	GetMachine(ctx context.Context, id string) (*models.Machine, error)
+
+	// ListMachines returns every machine ordered by name.
+	ListMachines(ctx context.Context) ([]*models.Machine, error)
+
+	// UpdateMachine save machine name, location and status.
+	UpdateMachine(ctx context.Context, machine *models.Machine) error
+	DeleteMachine(ctx context.Context, id string) (*models.Machine, error)
+
+	CreateSlot(ctx context.Context, slot *models.Slot) error
+	GetSlot(ctx context.Context, machineID string, code string) (*models.Slot, error)
+
+	// ListSlots returns every slot of the machine ordered by code.
+	ListSlots(ctx context.Context, machineID string) ([]*models.Slot, error)
+
+	// ProductSlots returns every slot holding the product, in any machine.
+	ProductSlots(ctx context.Context, productID string) ([]*models.Slot, error)
+
+	// UpdateSlot save slot product, capacity and count.
+	UpdateSlot(ctx context.Context, slot *models.Slot) error
+	DeleteSlot(ctx context.Context, machineID string, code string) (*models.Slot, error)
+
+	// IncrementSlotCount add quantity to the slot count and returns the updated slot, an
+	// update taking the count below zero or above the slot capacity is rejected with
+	// ErrConflict.
+	IncrementSlotCount(ctx context.Context, machineID string, code string, quantity int) (*models.Slot, error)
+}
+
+func (c *Connection) CreateMachine(ctx context.Context, machine *models.Machine) error {
+	_, err := c.machines().InsertOne(ctx, machine)
+	return duplicate(err)
+}
+
+func (c *Connection) GetMachine(ctx context.Context, id string) (*models.Machine, error) {
+	machine := models.Machine{}
+
+	err := c.machines().FindOne(ctx, bson.M{"_id": id}).Decode(&machine)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &machine, nil
+}
+
+func (c *Connection) ListMachines(ctx context.Context) ([]*models.Machine, error) {
+	cur, err := c.machines().Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	machines := []*models.Machine{}
+	if err := cur.All(ctx, &machines); err != nil {
+		return nil, err
+	}
+
+	return machines, nil
+}
+
+func (c *Connection) UpdateMachine(ctx context.Context, machine *models.Machine) error {
+	res, err := c.machines().UpdateOne(ctx, bson.M{"_id": machine.ID}, bson.M{"$set": bson.M{
+		"name":     machine.Name,
+		"location": machine.Location,
+		"status":   machine.Status,
+	}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *Connection) DeleteMachine(ctx context.Context, id string) (*models.Machine, error) {
+	machine := models.Machine{}
+
+	err := c.machines().FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&machine)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &machine, nil
+}
+
+func (c *Connection) CreateSlot(ctx context.Context, slot *models.Slot) error {
+	_, err := c.slots().InsertOne(ctx, slot)
+	return duplicate(err)
+}
+
+func (c *Connection) GetSlot(ctx context.Context, machineID string, code string) (*models.Slot, error) {
+	slot := models.Slot{}
+
+	err := c.slots().FindOne(ctx, bson.M{"_id": models.SlotID(machineID, code)}).Decode(&slot)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &slot, nil
+}
+
+func (c *Connection) ListSlots(ctx context.Context, machineID string) ([]*models.Slot, error) {
+	cur, err := c.slots().Find(ctx, bson.M{"machineid": machineID}, options.Find().SetSort(bson.D{{Key: "code", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []*models.Slot{}
+	if err := cur.All(ctx, &slots); err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+func (c *Connection) ProductSlots(ctx context.Context, productID string) ([]*models.Slot, error) {
+	cur, err := c.slots().Find(ctx, bson.M{"productid": productID})
+	if err != nil {
+		return nil, err
+	}
+
+	slots := []*models.Slot{}
+	if err := cur.All(ctx, &slots); err != nil {
+		return nil, err
+	}
+
+	return slots, nil
+}
+
+func (c *Connection) UpdateSlot(ctx context.Context, slot *models.Slot) error {
+	res, err := c.slots().UpdateOne(ctx, bson.M{"_id": slot.ID}, bson.M{"$set": bson.M{
+		"productid": slot.ProductID,
+		"capacity":  slot.Capacity,
+		"count":     slot.Count,
+	}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *Connection) DeleteSlot(ctx context.Context, machineID string, code string) (*models.Slot, error) {
+	slot := models.Slot{}
+
+	err := c.slots().FindOneAndDelete(ctx, bson.M{"_id": models.SlotID(machineID, code)}).Decode(&slot)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &slot, nil
+}
+
+func (c *Connection) IncrementSlotCount(ctx context.Context, machineID string, code string, quantity int) (*models.Slot, error) {
+	id := models.SlotID(machineID, code)
+	filter := bson.M{"_id": id}
+	if quantity < 0 {
+		filter["count"] = bson.M{"$gte": -quantity}
+	} else {
+		filter["$expr"] = bson.M{"$lte": bson.A{bson.M{"$add": bson.A{"$count", quantity}}, "$capacity"}}
+	}
+
+	slot := models.Slot{}
+	err := c.slots().FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"count": quantity}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&slot)
+	if err != nil {
+		err = notFound(err)
+		if err == ErrNotFound {
+			// tell apart a missing slot from a count out of bounds.
+			if _, err := c.GetSlot(ctx, machineID, code); err != nil {
+				return nil, err
+			}
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	return &slot, nil
+}
+
+func (m *Memory) CreateMachine(ctx context.Context, machine *models.Machine) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.machines[machine.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.machines[machine.ID] = *machine
+
+	return nil
+}
+
+func (m *Memory) GetMachine(ctx context.Context, id string) (*models.Machine, error) {
+	defer m.lock(ctx)()
+
+	machine, ok := m.data.machines[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &machine, nil
+}
+
+func (m *Memory) ListMachines(ctx context.Context) ([]*models.Machine, error) {
+	defer m.lock(ctx)()
+
+	machines := []*models.Machine{}
+	for _, machine := range m.data.machines {
+		machine := machine
+		machines = append(machines, &machine)
+	}
+
+	sort.Slice(machines, func(i, j int) bool {
+		if machines[i].Name == machines[j].Name {
+			return machines[i].ID < machines[j].ID
+		}
+
+		return machines[i].Name < machines[j].Name
+	})
+
+	return machines, nil
+}
+
+func (m *Memory) UpdateMachine(ctx context.Context, machine *models.Machine) error {
+	defer m.lock(ctx)()
+
+	stored, ok := m.data.machines[machine.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored.Name = machine.Name
+	stored.Location = machine.Location
+	stored.Status = machine.Status
+	m.data.machines[machine.ID] = stored
+
+	return nil
+}
+
+func (m *Memory) DeleteMachine(ctx context.Context, id string) (*models.Machine, error) {
+	defer m.lock(ctx)()
+
+	machine, ok := m.data.machines[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	delete(m.data.machines, id)
+
+	return &machine, nil
+}
+
+func (m *Memory) CreateSlot(ctx context.Context, slot *models.Slot) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.slots[slot.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.slots[slot.ID] = *slot
+
+	return nil
+}
+
+func (m *Memory) GetSlot(ctx context.Context, machineID string, code string) (*models.Slot, error) {
+	defer m.lock(ctx)()
+
+	slot, ok := m.data.slots[models.SlotID(machineID, code)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &slot, nil
+}
+
+func (m *Memory) ListSlots(ctx context.Context, machineID string) ([]*models.Slot, error) {
+	defer m.lock(ctx)()
+
+	slots := []*models.Slot{}
+	for _, slot := range m.data.slots {
+		slot := slot
+		if slot.MachineID == machineID {
+			slots = append(slots, &slot)
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].Code < slots[j].Code
+	})
+
+	return slots, nil
+}
+
+func (m *Memory) ProductSlots(ctx context.Context, productID string) ([]*models.Slot, error) {
+	defer m.lock(ctx)()
+
+	slots := []*models.Slot{}
+	for _, slot := range m.data.slots {
+		slot := slot
+		if slot.ProductID == productID {
+			slots = append(slots, &slot)
+		}
+	}
+
+	return slots, nil
+}
+
+func (m *Memory) UpdateSlot(ctx context.Context, slot *models.Slot) error {
+	defer m.lock(ctx)()
+
+	stored, ok := m.data.slots[slot.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored.ProductID = slot.ProductID
+	stored.Capacity = slot.Capacity
+	stored.Count = slot.Count
+	m.data.slots[slot.ID] = stored
+
+	return nil
+}
+
+func (m *Memory) DeleteSlot(ctx context.Context, machineID string, code string) (*models.Slot, error) {
+	defer m.lock(ctx)()
+
+	id := models.SlotID(machineID, code)
+	slot, ok := m.data.slots[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	delete(m.data.slots, id)
+
+	return &slot, nil
+}
+
+func (m *Memory) IncrementSlotCount(ctx context.Context, machineID string, code string, quantity int) (*models.Slot, error) {
+	defer m.lock(ctx)()
+
+	id := models.SlotID(machineID, code)
+	slot, ok := m.data.slots[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if slot.Count+quantity < 0 || slot.Count+quantity > slot.Capacity {
+		return nil, ErrConflict
+	}
+
+	slot.Count += quantity
+	m.data.slots[id] = slot
+
+	return &slot, nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bcmmbaga/vending-machine/models"
+)
+
+type memoryTxKey struct{}
+
+// Memory is a thread-safe in-memory Store meant for tests and local development, its
+// state is lost once the process exits.
+type Memory struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+// memoryData holds every collection of the Memory store, documents are stored by value
+// so callers never share memory with the store.
+type memoryData struct {
+	users              map[string]models.User
+	products           map[string]models.Product
+	machines           map[string]models.Machine
+	slots              map[string]models.Slot
+	sessions           map[string]models.Session
+	loginAttempts      map[string]models.LoginAttempts
+	passwordResets     map[string]models.PasswordReset
+	apiKeys            map[string]models.APIKey
+	idempotentRequests map[string]models.IdempotentRequest
+	coins              map[string]models.CoinInventory
+	refunds            []models.Refund
+	cashMovements      []models.CashMovement
+	orders             []models.Order
+	checkouts          map[string]models.Checkout
+	ledger             []models.LedgerEntry
+	audit              []models.AuditEntry
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{data: &memoryData{
+		users:              map[string]models.User{},
+		products:           map[string]models.Product{},
+		machines:           map[string]models.Machine{},
+		slots:              map[string]models.Slot{},
+		sessions:           map[string]models.Session{},
+		loginAttempts:      map[string]models.LoginAttempts{},
+		passwordResets:     map[string]models.PasswordReset{},
+		apiKeys:            map[string]models.APIKey{},
+		idempotentRequests: map[string]models.IdempotentRequest{},
+		coins:              map[string]models.CoinInventory{},
+		checkouts:          map[string]models.Checkout{},
+	}}
+}
+
+// clone returns a copy of the data, it is used to roll back failed transactions.
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		users:              make(map[string]models.User, len(d.users)),
+		products:           make(map[string]models.Product, len(d.products)),
+		machines:           make(map[string]models.Machine, len(d.machines)),
+		slots:              make(map[string]models.Slot, len(d.slots)),
+		sessions:           make(map[string]models.Session, len(d.sessions)),
+		loginAttempts:      make(map[string]models.LoginAttempts, len(d.loginAttempts)),
+		passwordResets:     make(map[string]models.PasswordReset, len(d.passwordResets)),
+		apiKeys:            make(map[string]models.APIKey, len(d.apiKeys)),
+		idempotentRequests: make(map[string]models.IdempotentRequest, len(d.idempotentRequests)),
+		coins:              make(map[string]models.CoinInventory, len(d.coins)),
+		refunds:            make([]models.Refund, len(d.refunds)),
+		cashMovements:      make([]models.CashMovement, len(d.cashMovements)),
+		orders:             make([]models.Order, len(d.orders)),
+		checkouts:          make(map[string]models.Checkout, len(d.checkouts)),
+		ledger:             make([]models.LedgerEntry, len(d.ledger)),
+		audit:              make([]models.AuditEntry, len(d.audit)),
+	}
+
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+
+	for k, v := range d.products {
+		c.products[k] = v
+	}
+
+	for k, v := range d.machines {
+		c.machines[k] = v
+	}
+
+	for k, v := range d.slots {
+		c.slots[k] = v
+	}
+
+	for k, v := range d.sessions {
+		c.sessions[k] = v
+	}
+
+	for k, v := range d.loginAttempts {
+		c.loginAttempts[k] = v
+	}
+
+	for k, v := range d.passwordResets {
+		c.passwordResets[k] = v
+	}
+
+	for k, v := range d.apiKeys {
+		c.apiKeys[k] = v
+	}
+
+	for k, v := range d.idempotentRequests {
+		c.idempotentRequests[k] = v
+	}
+
+	// checkouts are never updated so sharing their line items is safe.
+	for k, v := range d.checkouts {
+		c.checkouts[k] = v
+	}
+
+	copy(c.refunds, d.refunds)
+	copy(c.cashMovements, d.cashMovements)
+	copy(c.orders, d.orders)
+	copy(c.ledger, d.ledger)
+	copy(c.audit, d.audit)
+
+	// inventories are replaced on every write so sharing them is safe.
+	for k, v := range d.coins {
+		c.coins[k] = v
+	}
+
+	return c
+}
+
+// lock acquire the store lock unless ctx belongs to a transaction already holding it, the
+// returned function release the lock.
+func (m *Memory) lock(ctx context.Context) func() {
+	if ctx.Value(memoryTxKey{}) == m {
+		return func() {}
+	}
+
+	m.mu.Lock()
+	return m.mu.Unlock
+}
+
+// WithTransaction runs fn holding the store lock, the data is restored to its previous
+// state when fn returns an error.
+func (m *Memory) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{}) == m {
+		return fn(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := m.data.clone()
+
+	err := fn(context.WithValue(ctx, memoryTxKey{}, m))
+	if err != nil {
+		m.data = snapshot
+		return err
+	}
+
+	return nil
+}
+
+func (m *Memory) Close(ctx context.Context) error {
+	return nil
+}
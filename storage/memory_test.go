@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryIncrementDepositConcurrently(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+
+	err := store.CreateUser(ctx, &models.User{Username: "buyer1", Roles: []string{"buyer"}, Deposit: 100})
+	assert.NoError(t, err)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			_, err := store.IncrementDeposit(ctx, "buyer1", -10)
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+				return
+			}
+
+			assert.Equal(t, ErrConflict, err)
+		}()
+	}
+
+	wg.Wait()
+
+	user, err := store.GetUser(ctx, "buyer1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 10, succeeded)
+	assert.Equal(t, 0, user.Deposit)
+}
+
+func TestMemoryTransactionRollback(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+
+	err := store.CreateUser(ctx, &models.User{Username: "buyer1", Roles: []string{"buyer"}, Deposit: 100})
+	assert.NoError(t, err)
+
+	err = store.CreateProduct(ctx, &models.Product{ID: "p1", Name: "testing", Available: 1, Cost: 10})
+	assert.NoError(t, err)
+
+	errAbort := errors.New("abort")
+	err = store.WithTransaction(ctx, func(ctx context.Context) error {
+		_, err := store.IncrementDeposit(ctx, "buyer1", -10)
+		assert.NoError(t, err)
+
+		_, err = store.IncrementStock(ctx, "p1", -1)
+		assert.NoError(t, err)
+
+		return errAbort
+	})
+	assert.Equal(t, errAbort, err)
+
+	user, err := store.GetUser(ctx, "buyer1")
+	assert.NoError(t, err)
+	assert.Equal(t, 100, user.Deposit)
+
+	product, err := store.GetProduct(ctx, "p1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, product.Available)
+}
+
+func TestMemoryUpdateProductKeepsStock(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+
+	err := store.CreateProduct(ctx, &models.Product{ID: "p1", Name: "testing", Available: 5, Cost: 10})
+	assert.NoError(t, err)
+
+	// the stock moves after the product was read, updating other fields must not undo it.
+	_, err = store.IncrementStock(ctx, "p1", -2)
+	assert.NoError(t, err)
+
+	product, err := store.UpdateProduct(ctx, "p1", models.ProductUpdate{Name: "renamed", Cost: 15})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Product{ID: "p1", Name: "renamed", Available: 3, Cost: 15}, *product)
+}
+
+func TestMemoryUpdateTOTPKeepsUser(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+
+	err := store.CreateUser(ctx, &models.User{Username: "seller1", Roles: []string{"seller"}})
+	assert.NoError(t, err)
+
+	user, err := store.GetUser(ctx, "seller1")
+	assert.NoError(t, err)
+
+	// an admin suspends the user after it was read, enrolling its second factor must not
+	// undo it.
+	suspended := *user
+	suspended.Suspended = true
+	err = store.UpdateUser(ctx, &suspended)
+	assert.NoError(t, err)
+
+	err = store.UpdateTOTP(ctx, "seller1", models.TOTP{Secret: "secret"})
+	assert.NoError(t, err)
+
+	user, err = store.GetUser(ctx, "seller1")
+	assert.NoError(t, err)
+	assert.True(t, user.Suspended)
+	assert.Equal(t, "secret", user.TOTP.Secret)
+
+	err = store.UpdateTOTP(ctx, "unknown", models.TOTP{})
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestMemoryUpdatePasswordKeepsUser(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemory()
+
+	err := store.CreateUser(ctx, &models.User{Username: "buyer1", Password: "old", Roles: []string{"buyer"}})
+	assert.NoError(t, err)
+
+	// the roles change after the user was read, changing its password must not undo it.
+	err = store.UpdateUser(ctx, &models.User{Username: "buyer1", Password: "old", Roles: []string{"buyer", "seller"}})
+	assert.NoError(t, err)
+
+	err = store.UpdatePassword(ctx, "buyer1", "new")
+	assert.NoError(t, err)
+
+	user, err := store.GetUser(ctx, "buyer1")
+	assert.NoError(t, err)
+	assert.Equal(t, "new", user.Password)
+	assert.Equal(t, []string{"buyer", "seller"}, user.Roles)
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OrderStore describe persistence of purchase orders.
+type OrderStore interface {
+	CreateOrder(ctx context.Context, order *models.Order) error
+	GetOrder(ctx context.Context, id string) (*models.Order, error)
+
+	// ListOrders returns up to query.Limit orders of the buyer, newest first.
+	ListOrders(ctx context.Context, query *models.OrderQuery) ([]*models.Order, error)
+}
+
+func (c *Connection) CreateOrder(ctx context.Context, order *models.Order) error {
+	_, err := c.orders().InsertOne(ctx, order)
+	return duplicate(err)
+}
+
+func (c *Connection) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	order := models.Order{}
+
+	err := c.orders().FindOne(ctx, bson.M{"_id": id}).Decode(&order)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &order, nil
+}
+
+func (c *Connection) ListOrders(ctx context.Context, query *models.OrderQuery) ([]*models.Order, error) {
+	filter := bson.M{"buyer": query.Buyer}
+
+	if query.Before != nil {
+		filter["$or"] = bson.A{
+			bson.M{"createdat": bson.M{"$lt": query.Before.CreatedAt}},
+			bson.M{"createdat": query.Before.CreatedAt, "_id": bson.M{"$lt": query.Before.ID}},
+		}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}, {Key: "_id", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+
+	cur, err := c.orders().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	orders := []*models.Order{}
+	if err := cur.All(ctx, &orders); err != nil {
+		return nil, err
+	}
+
+	return orders, nil
+}
+
+func (m *Memory) CreateOrder(ctx context.Context, order *models.Order) error {
+	defer m.lock(ctx)()
+
+	for _, stored := range m.data.orders {
+		if stored.ID == order.ID {
+			return ErrDuplicate
+		}
+	}
+
+	m.data.orders = append(m.data.orders, *order)
+
+	return nil
+}
+
+func (m *Memory) GetOrder(ctx context.Context, id string) (*models.Order, error) {
+	defer m.lock(ctx)()
+
+	for _, order := range m.data.orders {
+		if order.ID == id {
+			return &order, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (m *Memory) ListOrders(ctx context.Context, query *models.OrderQuery) ([]*models.Order, error) {
+	defer m.lock(ctx)()
+
+	orders := []*models.Order{}
+	for _, order := range m.data.orders {
+		order := order
+
+		if order.Buyer != query.Buyer {
+			continue
+		}
+
+		if query.Before != nil && !order.Older(query.Before) {
+			continue
+		}
+
+		orders = append(orders, &order)
+	}
+
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[j].Older(orders[i])
+	})
+
+	if query.Limit > 0 && len(orders) > query.Limit {
+		orders = orders[:query.Limit]
+	}
+
+	return orders, nil
+}
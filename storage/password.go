@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PasswordResetStore describe persistence of password reset tokens.
+type PasswordResetStore interface {
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+
+	// UsePasswordReset mark the password reset as used and returns it, it returns
+	// ErrNotFound when the reset does not exist, was already used or expired before now.
+	UsePasswordReset(ctx context.Context, id string, now time.Time) (*models.PasswordReset, error)
+}
+
+func (c *Connection) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	_, err := c.passwordResets().InsertOne(ctx, reset)
+	return duplicate(err)
+}
+
+func (c *Connection) UsePasswordReset(ctx context.Context, id string, now time.Time) (*models.PasswordReset, error) {
+	reset := models.PasswordReset{}
+
+	err := c.passwordResets().FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "used": false, "expiresat": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used": true}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&reset)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &reset, nil
+}
+
+func (m *Memory) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.passwordResets[reset.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.passwordResets[reset.ID] = *reset
+
+	return nil
+}
+
+func (m *Memory) UsePasswordReset(ctx context.Context, id string, now time.Time) (*models.PasswordReset, error) {
+	defer m.lock(ctx)()
+
+	reset, ok := m.data.passwordResets[id]
+	if !ok || reset.Used || !now.Before(reset.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+
+	reset.Used = true
+	m.data.passwordResets[id] = reset
+
+	return &reset, nil
+}
@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ProductStore describe persistence of products offered by sellers.
+type ProductStore interface {
+	CreateProduct(ctx context.Context, product *models.Product) error
+	GetProduct(ctx context.Context, id string) (*models.Product, error)
+
+	// UpdateProduct set the non zero fields of update on the product and returns the updated
+	// product, other fields are left untouched so concurrent stock increments are kept.
+	UpdateProduct(ctx context.Context, id string, update models.ProductUpdate) (*models.Product, error)
+	DeleteProduct(ctx context.Context, id string) (*models.Product, error)
+
+	// IncrementStock add quantity to the product available quantity and returns the updated
+	// product, a negative quantity larger than what is available is rejected with ErrConflict.
+	IncrementStock(ctx context.Context, id string, quantity int) (*models.Product, error)
+
+	// ListProducts returns up to query.Limit products matching the query in its sort order.
+	ListProducts(ctx context.Context, query *models.ProductQuery) ([]*models.Product, error)
+}
+
+func (c *Connection) CreateProduct(ctx context.Context, product *models.Product) error {
+	_, err := c.products().InsertOne(ctx, product)
+	return duplicate(err)
+}
+
+func (c *Connection) GetProduct(ctx context.Context, id string) (*models.Product, error) {
+	product := models.Product{}
+
+	err := c.products().FindOne(ctx, bson.M{"_id": id}).Decode(&product)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &product, nil
+}
+
+func (c *Connection) UpdateProduct(ctx context.Context, id string, update models.ProductUpdate) (*models.Product, error) {
+	set := bson.M{}
+	if update.Name != "" {
+		set["name"] = update.Name
+	}
+
+	if update.Available != 0 {
+		set["available"] = update.Available
+	}
+
+	if update.Cost != 0 {
+		set["cost"] = update.Cost
+	}
+
+	if len(set) == 0 {
+		return c.GetProduct(ctx, id)
+	}
+
+	product := models.Product{}
+	err := c.products().FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &product, nil
+}
+
+func (c *Connection) DeleteProduct(ctx context.Context, id string) (*models.Product, error) {
+	product := models.Product{}
+
+	err := c.products().FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&product)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &product, nil
+}
+
+func (c *Connection) IncrementStock(ctx context.Context, id string, quantity int) (*models.Product, error) {
+	filter := bson.M{"_id": id}
+	if quantity < 0 {
+		filter["available"] = bson.M{"$gte": -quantity}
+	}
+
+	product := models.Product{}
+	err := c.products().FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"available": quantity}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+	if err != nil {
+		err = notFound(err)
+		if err == ErrNotFound && quantity < 0 {
+			// tell apart a missing product from a stock not covering the quantity.
+			if _, err := c.GetProduct(ctx, id); err != nil {
+				return nil, err
+			}
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+func (c *Connection) ListProducts(ctx context.Context, query *models.ProductQuery) ([]*models.Product, error) {
+	filter := bson.M{}
+
+	if query.SellerID != "" {
+		filter["sellerid"] = query.SellerID
+	}
+
+	cost := bson.M{}
+	if query.MinCost != 0 {
+		cost["$gte"] = query.MinCost
+	}
+
+	if query.MaxCost != 0 {
+		cost["$lte"] = query.MaxCost
+	}
+
+	if len(cost) > 0 {
+		filter["cost"] = cost
+	}
+
+	if query.InStock {
+		filter["available"] = bson.M{"$gt": 0}
+	}
+
+	if query.Search != "" {
+		filter["name"] = primitive.Regex{Pattern: regexp.QuoteMeta(query.Search), Options: "i"}
+	}
+
+	sortField := productSortField(query.SortBy)
+	direction, after := 1, "$gt"
+	if query.Descending {
+		direction, after = -1, "$lt"
+	}
+
+	if query.After != nil {
+		value := productSortValue(query.After, query.SortBy)
+
+		// keyset pagination, continue after the (sort field, _id) pair of the last product.
+		filter["$and"] = bson.A{bson.M{"$or": bson.A{
+			bson.M{sortField: bson.M{after: value}},
+			bson.M{sortField: value, "_id": bson.M{after: query.After.ID}},
+		}}}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: sortField, Value: direction}, {Key: "_id", Value: direction}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+
+	cur, err := c.products().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	products := []*models.Product{}
+	if err := cur.All(ctx, &products); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+func productSortField(sortBy string) string {
+	switch sortBy {
+	case models.SortByCost, models.SortByAvailable:
+		return sortBy
+	default:
+		return models.SortByName
+	}
+}
+
+func productSortValue(product *models.Product, sortBy string) interface{} {
+	switch sortBy {
+	case models.SortByCost:
+		return product.Cost
+	case models.SortByAvailable:
+		return product.Available
+	default:
+		return product.Name
+	}
+}
+
+func (m *Memory) CreateProduct(ctx context.Context, product *models.Product) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.products[product.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.products[product.ID] = *product
+
+	return nil
+}
+
+func (m *Memory) GetProduct(ctx context.Context, id string) (*models.Product, error) {
+	defer m.lock(ctx)()
+
+	product, ok := m.data.products[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &product, nil
+}
+
+func (m *Memory) UpdateProduct(ctx context.Context, id string, update models.ProductUpdate) (*models.Product, error) {
+	defer m.lock(ctx)()
+
+	stored, ok := m.data.products[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if update.Name != "" {
+		stored.Name = update.Name
+	}
+
+	if update.Available != 0 {
+		stored.Available = update.Available
+	}
+
+	if update.Cost != 0 {
+		stored.Cost = update.Cost
+	}
+
+	m.data.products[id] = stored
+
+	return &stored, nil
+}
+
+func (m *Memory) DeleteProduct(ctx context.Context, id string) (*models.Product, error) {
+	defer m.lock(ctx)()
+
+	product, ok := m.data.products[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	delete(m.data.products, id)
+
+	return &product, nil
+}
+
+func (m *Memory) IncrementStock(ctx context.Context, id string, quantity int) (*models.Product, error) {
+	defer m.lock(ctx)()
+
+	product, ok := m.data.products[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if product.Available+quantity < 0 {
+		return nil, ErrConflict
+	}
+
+	product.Available += quantity
+	m.data.products[id] = product
+
+	return &product, nil
+}
+
+func (m *Memory) ListProducts(ctx context.Context, query *models.ProductQuery) ([]*models.Product, error) {
+	defer m.lock(ctx)()
+
+	products := []*models.Product{}
+	for _, product := range m.data.products {
+		product := product
+
+		if !query.Matches(&product) {
+			continue
+		}
+
+		if query.After != nil && !query.Less(query.After, &product) {
+			continue
+		}
+
+		products = append(products, &product)
+	}
+
+	sort.Slice(products, func(i, j int) bool {
+		return query.Less(products[i], products[j])
+	})
+
+	if query.Limit > 0 && len(products) > query.Limit {
+		products = products[:query.Limit]
+	}
+
+	return products, nil
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/bcmmbaga/vending-machine/models"
+)
+
+// RefundStore describe persistence of deposit refunds.
+type RefundStore interface {
+	CreateRefund(ctx context.Context, refund *models.Refund) error
+}
+
+func (c *Connection) CreateRefund(ctx context.Context, refund *models.Refund) error {
+	_, err := c.refunds().InsertOne(ctx, refund)
+	return duplicate(err)
+}
+
+func (m *Memory) CreateRefund(ctx context.Context, refund *models.Refund) error {
+	defer m.lock(ctx)()
+
+	m.data.refunds = append(m.data.refunds, *refund)
+
+	return nil
+}
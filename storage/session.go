@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SessionStore describe persistence of user login sessions.
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+
+	// ActiveSessions returns every active session of the user, oldest first.
+	ActiveSessions(ctx context.Context, username string) ([]*models.Session, error)
+
+	// RotateRefreshToken save the refresh token fields of an active session whose current
+	// refresh token hash is previous, it returns ErrConflict otherwise.
+	RotateRefreshToken(ctx context.Context, session *models.Session, previous string) error
+
+	// RevokeSession mark the session as inactive.
+	RevokeSession(ctx context.Context, id string) error
+
+	// RevokeSessions mark every session of the user as inactive.
+	RevokeSessions(ctx context.Context, username string) error
+}
+
+func (c *Connection) CreateSession(ctx context.Context, session *models.Session) error {
+	_, err := c.sessions().InsertOne(ctx, session)
+	return duplicate(err)
+}
+
+func (c *Connection) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	session := models.Session{}
+
+	err := c.sessions().FindOne(ctx, bson.M{"_id": id}).Decode(&session)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &session, nil
+}
+
+func (c *Connection) ActiveSessions(ctx context.Context, username string) ([]*models.Session, error) {
+	cur, err := c.sessions().Find(ctx, bson.M{"username": username, "status": models.SessionActive},
+		options.Find().SetSort(bson.D{{Key: "createdat", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*models.Session{}
+	if err := cur.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (c *Connection) RotateRefreshToken(ctx context.Context, session *models.Session, previous string) error {
+	res, err := c.sessions().UpdateOne(ctx, bson.M{
+		"_id":          session.ID,
+		"status":       models.SessionActive,
+		"refreshtoken": previous,
+	}, bson.M{
+		"$set": bson.M{
+			"refreshtoken":         session.RefreshToken,
+			"previousrefreshtoken": session.PreviousRefreshToken,
+			"expiresat":            session.ExpiresAt,
+		},
+		// sessions rotated before only the previous refresh token was kept.
+		"$unset": bson.M{"usedrefreshtokens": ""},
+	})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+func (c *Connection) RevokeSession(ctx context.Context, id string) error {
+	res, err := c.sessions().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"status": models.SessionInactive,
+	}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *Connection) RevokeSessions(ctx context.Context, username string) error {
+	_, err := c.sessions().UpdateMany(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{
+		"status": models.SessionInactive,
+	}})
+
+	return err
+}
+
+func (m *Memory) CreateSession(ctx context.Context, session *models.Session) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.sessions[session.ID]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.sessions[session.ID] = *session
+
+	return nil
+}
+
+func (m *Memory) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	defer m.lock(ctx)()
+
+	session, ok := m.data.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &session, nil
+}
+
+func (m *Memory) ActiveSessions(ctx context.Context, username string) ([]*models.Session, error) {
+	defer m.lock(ctx)()
+
+	sessions := []*models.Session{}
+	for _, session := range m.data.sessions {
+		if session.Username == username && session.Status == models.SessionActive {
+			session := session
+			sessions = append(sessions, &session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].ID < sessions[j].ID
+		}
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions, nil
+}
+
+func (m *Memory) RotateRefreshToken(ctx context.Context, session *models.Session, previous string) error {
+	defer m.lock(ctx)()
+
+	current, ok := m.data.sessions[session.ID]
+	if !ok || current.Status != models.SessionActive || current.RefreshToken != previous {
+		return ErrConflict
+	}
+
+	current.RefreshToken = session.RefreshToken
+	current.PreviousRefreshToken = session.PreviousRefreshToken
+	current.ExpiresAt = session.ExpiresAt
+	m.data.sessions[session.ID] = current
+
+	return nil
+}
+
+func (m *Memory) RevokeSession(ctx context.Context, id string) error {
+	defer m.lock(ctx)()
+
+	session, ok := m.data.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	session.Status = models.SessionInactive
+	m.data.sessions[id] = session
+
+	return nil
+}
+
+func (m *Memory) RevokeSessions(ctx context.Context, username string) error {
+	defer m.lock(ctx)()
+
+	for id, session := range m.data.sessions {
+		if session.Username == username {
+			session.Status = models.SessionInactive
+			m.data.sessions[id] = session
+		}
+	}
+
+	return nil
+}
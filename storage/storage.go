@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrNotFound is returned when the requested document does not exist.
+	ErrNotFound = errors.New("storage: document not found")
+
+	// ErrDuplicate is returned when a document with the same key already exists.
+	ErrDuplicate = errors.New("storage: duplicate document")
+
+	// ErrConflict is returned when a guarded update is not applied because its condition
+	// is not met, e.g decrementing a balance below zero.
+	ErrConflict = errors.New("storage: update condition not met")
+)
+
+// Store describe persistence of vending machine state, it is implemented by the mongo
+// Connection and the in-memory Memory store.
+type Store interface {
+	UserStore
+	ProductStore
+	MachineStore
+	CashStore
+	SessionStore
+	LoginAttemptStore
+	PasswordResetStore
+	APIKeyStore
+	IdempotencyStore
+	CoinStore
+	RefundStore
+	OrderStore
+	CheckoutStore
+	LedgerStore
+	AuditStore
+
+	// WithTransaction runs fn atomically, every write made using the ctx passed to fn is
+	// discarded when fn returns an error.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+
+	// Close release resources held by the store.
+	Close(ctx context.Context) error
+}
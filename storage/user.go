@@ -0,0 +1,440 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"sort"
+
+	"github.com/bcmmbaga/vending-machine/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UserStore describe persistence of user accounts.
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUser(ctx context.Context, username string) (*models.User, error)
+
+	// UpdateUser save every user field except the deposit and earnings, which are only
+	// changed through IncrementDeposit, SetDeposit and IncrementEarnings.
+	UpdateUser(ctx context.Context, user *models.User) error
+
+	// UpdateTOTP save the two-factor authentication fields of the user only, so a
+	// concurrent update of other fields is kept.
+	UpdateTOTP(ctx context.Context, username string, totp models.TOTP) error
+
+	// UpdatePassword save the password hash of the user only.
+	UpdatePassword(ctx context.Context, username string, password string) error
+	DeleteUser(ctx context.Context, username string) (*models.User, error)
+
+	// IncrementDeposit add amount to the user deposit and returns the updated user, a
+	// negative amount larger than the deposit is rejected with ErrConflict.
+	IncrementDeposit(ctx context.Context, username string, amount int) (*models.User, error)
+
+	// SetDeposit replace the user deposit and returns the user as it was before the update.
+	SetDeposit(ctx context.Context, username string, deposit int) (*models.User, error)
+
+	// BindDeposit record the deposit of the user is held by the machine in currency, it
+	// returns ErrConflict when a non-zero deposit is held by another machine or counted in
+	// another currency.
+	BindDeposit(ctx context.Context, username string, machineID string, currency string) (*models.User, error)
+
+	// IncrementEarnings add amount to the seller earnings in currency and returns the updated
+	// user, a negative amount larger than the earnings in currency is rejected with
+	// ErrConflict.
+	IncrementEarnings(ctx context.Context, username string, currency string, amount int) (*models.User, error)
+
+	// ListUsers returns up to query.Limit users matching the query ordered by username.
+	ListUsers(ctx context.Context, query *models.UserQuery) ([]*models.User, error)
+}
+
+func (c *Connection) CreateUser(ctx context.Context, user *models.User) error {
+	_, err := c.users().InsertOne(ctx, user)
+	return duplicate(err)
+}
+
+func (c *Connection) GetUser(ctx context.Context, username string) (*models.User, error) {
+	user := models.User{}
+
+	err := c.users().FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &user, nil
+}
+
+func (c *Connection) UpdateUser(ctx context.Context, user *models.User) error {
+	buf, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	fields := bson.M{}
+	if err := bson.Unmarshal(buf, &fields); err != nil {
+		return err
+	}
+
+	delete(fields, "username")
+	delete(fields, "deposit")
+	delete(fields, "earnings")
+	delete(fields, "depositmachine")
+	delete(fields, "depositcurrency")
+
+	res, err := c.users().UpdateOne(ctx, bson.M{"username": user.Username}, bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *Connection) UpdateTOTP(ctx context.Context, username string, totp models.TOTP) error {
+	res, err := c.users().UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"totp": totp}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *Connection) UpdatePassword(ctx context.Context, username string, password string) error {
+	res, err := c.users().UpdateOne(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"password": password}})
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (c *Connection) DeleteUser(ctx context.Context, username string) (*models.User, error) {
+	user := models.User{}
+
+	err := c.users().FindOneAndDelete(ctx, bson.M{"username": username}).Decode(&user)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &user, nil
+}
+
+func (c *Connection) IncrementDeposit(ctx context.Context, username string, amount int) (*models.User, error) {
+	return c.incrementBalance(ctx, username, "deposit", amount)
+}
+
+func (c *Connection) IncrementEarnings(ctx context.Context, username string, currency string, amount int) (*models.User, error) {
+	return c.incrementBalance(ctx, username, "earnings."+currency, amount)
+}
+
+// incrementBalance add amount to the balance field of the user, the update only matches when
+// the balance covers a negative amount.
+func (c *Connection) incrementBalance(ctx context.Context, username string, field string, amount int) (*models.User, error) {
+	filter := bson.M{"username": username}
+	if amount < 0 {
+		filter[field] = bson.M{"$gte": -amount}
+	}
+
+	user := models.User{}
+	err := c.users().FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{field: amount}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		err = notFound(err)
+		if err == ErrNotFound && amount < 0 {
+			// tell apart a missing user from a balance not covering the amount.
+			if _, err := c.GetUser(ctx, username); err != nil {
+				return nil, err
+			}
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (c *Connection) BindDeposit(ctx context.Context, username string, machineID string, currency string) (*models.User, error) {
+	filter := bson.M{"username": username, "$or": bson.A{
+		bson.M{"deposit": 0},
+		bson.M{
+			"depositmachine":  bson.M{"$in": bson.A{nil, "", machineID}},
+			"depositcurrency": bson.M{"$in": bson.A{nil, "", currency}},
+		},
+	}}
+
+	update := bson.M{"$set": bson.M{"depositmachine": machineID, "depositcurrency": currency}}
+
+	user := models.User{}
+	err := c.users().FindOneAndUpdate(ctx, filter, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		err = notFound(err)
+		if err == ErrNotFound {
+			// tell apart a missing user from a deposit held by another machine.
+			if _, err := c.GetUser(ctx, username); err != nil {
+				return nil, err
+			}
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (c *Connection) SetDeposit(ctx context.Context, username string, deposit int) (*models.User, error) {
+	user := models.User{}
+
+	err := c.users().FindOneAndUpdate(ctx, bson.M{"username": username}, bson.M{"$set": bson.M{"deposit": deposit}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&user)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &user, nil
+}
+
+func (c *Connection) ListUsers(ctx context.Context, query *models.UserQuery) ([]*models.User, error) {
+	username := bson.M{}
+
+	if query.Search != "" {
+		username["$regex"] = primitive.Regex{Pattern: regexp.QuoteMeta(query.Search), Options: "i"}
+	}
+
+	if query.After != "" {
+		username["$gt"] = query.After
+	}
+
+	filter := bson.M{}
+	if len(username) > 0 {
+		filter["username"] = username
+	}
+
+	if query.DepositMachine != "" {
+		filter["depositmachine"] = query.DepositMachine
+		filter["deposit"] = bson.M{"$ne": 0}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "username", Value: 1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+
+	cur, err := c.users().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*models.User{}
+	if err := cur.All(ctx, &users); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, user *models.User) error {
+	defer m.lock(ctx)()
+
+	if _, ok := m.data.users[user.Username]; ok {
+		return ErrDuplicate
+	}
+
+	m.data.users[user.Username] = *user
+
+	return nil
+}
+
+func (m *Memory) GetUser(ctx context.Context, username string) (*models.User, error) {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, user *models.User) error {
+	defer m.lock(ctx)()
+
+	stored, ok := m.data.users[user.Username]
+	if !ok {
+		return ErrNotFound
+	}
+
+	updated := *user
+	updated.Deposit = stored.Deposit
+	updated.Earnings = stored.Earnings
+	updated.DepositMachine = stored.DepositMachine
+	updated.DepositCurrency = stored.DepositCurrency
+	m.data.users[user.Username] = updated
+
+	return nil
+}
+
+func (m *Memory) UpdateTOTP(ctx context.Context, username string, totp models.TOTP) error {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+
+	totp.RecoveryCodes = append([]string(nil), totp.RecoveryCodes...)
+	user.TOTP = totp
+	m.data.users[username] = user
+
+	return nil
+}
+
+func (m *Memory) UpdatePassword(ctx context.Context, username string, password string) error {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+
+	user.Password = password
+	m.data.users[username] = user
+
+	return nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, username string) (*models.User, error) {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	delete(m.data.users, username)
+
+	return &user, nil
+}
+
+func (m *Memory) IncrementDeposit(ctx context.Context, username string, amount int) (*models.User, error) {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if user.Deposit+amount < 0 {
+		return nil, ErrConflict
+	}
+
+	user.Deposit += amount
+	m.data.users[username] = user
+
+	return &user, nil
+}
+
+func (m *Memory) IncrementEarnings(ctx context.Context, username string, currency string, amount int) (*models.User, error) {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if user.Earnings[currency]+amount < 0 {
+		return nil, ErrConflict
+	}
+
+	// the map is shared with transaction snapshots, it is replaced instead of updated.
+	earnings := make(map[string]int, len(user.Earnings)+1)
+	for code, balance := range user.Earnings {
+		earnings[code] = balance
+	}
+	earnings[currency] += amount
+
+	user.Earnings = earnings
+	m.data.users[username] = user
+
+	return &user, nil
+}
+
+func (m *Memory) BindDeposit(ctx context.Context, username string, machineID string, currency string) (*models.User, error) {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if user.Deposit != 0 {
+		if user.DepositMachine != "" && user.DepositMachine != machineID {
+			return nil, ErrConflict
+		}
+
+		if user.DepositCurrency != "" && user.DepositCurrency != currency {
+			return nil, ErrConflict
+		}
+	}
+
+	user.DepositMachine = machineID
+	user.DepositCurrency = currency
+	m.data.users[username] = user
+
+	return &user, nil
+}
+
+func (m *Memory) SetDeposit(ctx context.Context, username string, deposit int) (*models.User, error) {
+	defer m.lock(ctx)()
+
+	user, ok := m.data.users[username]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	updated := user
+	updated.Deposit = deposit
+	m.data.users[username] = updated
+
+	return &user, nil
+}
+
+func (m *Memory) ListUsers(ctx context.Context, query *models.UserQuery) ([]*models.User, error) {
+	defer m.lock(ctx)()
+
+	users := []*models.User{}
+	for _, user := range m.data.users {
+		user := user
+
+		if !query.Matches(&user) || (query.After != "" && user.Username <= query.After) {
+			continue
+		}
+
+		users = append(users, &user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	if query.Limit > 0 && len(users) > query.Limit {
+		users = users[:query.Limit]
+	}
+
+	return users, nil
+}